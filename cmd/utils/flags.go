@@ -748,6 +748,14 @@ var (
 		Usage: "comma-separated URL's, holding metadata about network-support infrastructure (like S3 buckets with snapshots, bootnodes, etc...)",
 		Value: "",
 	}
+	WebSeedTorrentsWhenSnapStopFlag = cli.BoolFlag{
+		Name:  "webseed.torrents.snapstop",
+		Usage: "Download .torrent files (metadata only) from webseeds even if --" + ethconfig.FlagSnapStop + " is set",
+	}
+	WebSeedCommitmentTorrentsFlag = cli.BoolFlag{
+		Name:  "webseed.torrents.commitment",
+		Usage: "Download commitment .torrent files advertised by webseeds (skipped by default: not supported yet)",
+	}
 
 	// WithoutHeimdallFlag no heimdall (for testing purpose)
 	WithoutHeimdallFlag = cli.BoolFlag{
@@ -1546,6 +1554,11 @@ func SetEthConfig(ctx *cli.Context, nodeConfig *nodecfg.Config, cfg *ethconfig.C
 		if err != nil {
 			panic(err)
 		}
+		cfg.Downloader.SnapStop = !cfg.Snapshot.Produce
+		cfg.Downloader.WebSeedTorrentsWhenSnapStop = ctx.Bool(WebSeedTorrentsWhenSnapStopFlag.Name)
+		if ctx.Bool(WebSeedCommitmentTorrentsFlag.Name) {
+			cfg.Downloader.WebSeedSkipTorrent = func(string) bool { return false }
+		}
 		downloadernat.DoNat(nodeConfig.P2P.NAT, cfg.Downloader.ClientConfig, logger)
 	}
 
@@ -0,0 +1,38 @@
+package snaptype
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// FileClass - category of snapshot file
+type FileClass struct {
+	Category string // type of block snapshot ("headers", "bodies", ...) or domain/history of state file ("accounts", "commitment", ...). Empty - unknown
+	Ext      string // of data file: ".seg", ".kv", ".v", ".ef", ...
+}
+
+// FileClassifier - single place which knows naming of snapshot files. New types of files need only new classifier,
+// not edits of every rule (files filters, skip rules, ...) matching names
+type FileClassifier interface {
+	// Classify - `name` of data file or of its .torrent, may have dir
+	Classify(name string) FileClass
+}
+
+type FileClassifierFunc func(name string) FileClass
+
+func (f FileClassifierFunc) Classify(name string) FileClass { return f(name) }
+
+// DefaultFileClassifier - block snapshots: `v1-000000-000500-headers.seg`, state files: `accounts.0-32.kv`
+var DefaultFileClassifier FileClassifier = FileClassifierFunc(classifyByName)
+
+func classifyByName(name string) FileClass {
+	_, fName := filepath.Split(strings.TrimSuffix(name, ".torrent"))
+	if info, ok := ParseFileName("", fName); ok {
+		return FileClass{Category: info.T.String(), Ext: info.Ext}
+	}
+	category, _, ok := strings.Cut(fName, ".")
+	if !ok || category == "" {
+		return FileClass{}
+	}
+	return FileClass{Category: category, Ext: filepath.Ext(fName)}
+}
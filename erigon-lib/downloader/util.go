@@ -19,6 +19,7 @@ package downloader
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -292,24 +293,129 @@ func loadTorrent(torrentFilePath string) (*torrent.TorrentSpec, error) {
 	mi.AnnounceList = Trackers
 	return torrent.TorrentSpecFromMetaInfoErr(mi)
 }
-func saveTorrent(torrentFilePath string, res []byte) error {
+
+// safeTorrentPath - path of .torrent file `name` in rootDir, error if it escapes rootDir: by `..` in name or by symlink
+// (of parent dir or of file itself) pointing outside. rootDir itself may be symlink (for example, datadir on other disk)
+func safeTorrentPath(rootDir, name string) (string, error) {
+	root, err := filepath.EvalSymlinks(rootDir)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("torrent file name escapes dir: %s", name)
+	}
+	tPath := filepath.Join(rootDir, name)
+	resolved, err := filepath.EvalSymlinks(filepath.Dir(tPath))
+	if err != nil {
+		return "", err
+	}
+	resolved = filepath.Join(resolved, filepath.Base(tPath))
+	if info, err := os.Lstat(resolved); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if resolved, err = filepath.EvalSymlinks(resolved); err != nil { // dangling
+			return "", fmt.Errorf("torrent file is symlink: %s, %w", name, err)
+		}
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("torrent file path escapes dir by symlink: %s", name)
+	}
+	return tPath, nil
+}
+
+// saveTorrentFS - crash-safe write: temp file -> fsync -> rename -> fsync parent dir.
+// Without fsync of dir - rename may be lost on power-loss, without temp file - reader may see partial file.
+func saveTorrentFS(fs torrentFS, torrentFilePath string, res []byte) (err error) {
 	if len(res) == 0 {
 		return fmt.Errorf("try to write 0 bytes to file: %s", torrentFilePath)
 	}
-	f, err := os.Create(torrentFilePath)
+	dirPath, fName := filepath.Split(torrentFilePath)
+	f, err := fs.CreateTemp(dirPath, fName+".*.tmp")
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	if _, err = f.Write(res); err != nil {
-		return err
+	tmpPath := f.Name()
+	defer func() {
+		if err != nil {
+			_ = fs.Remove(tmpPath)
+		}
+	}()
+	if err = writeFull(f, res); err != nil {
+		f.Close()
+		return fmt.Errorf("write %s: %w", tmpPath, err)
 	}
 	if err = f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("fsync %s: %w", tmpPath, err)
+	}
+	if err = f.Close(); err != nil {
 		return err
 	}
+	if err = fs.Rename(tmpPath, torrentFilePath); err != nil {
+		return err
+	}
+	return fs.SyncDir(dirPath)
+}
+
+// writeFull - io.Writer allowed to return n < len(b) only with err, but don't trust it: check short writes explicitly
+func writeFull(w io.Writer, b []byte) error {
+	for len(b) > 0 {
+		n, err := w.Write(b)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.ErrShortWrite
+		}
+		b = b[n:]
+	}
 	return nil
 }
 
+type torrentFile interface {
+	io.Writer
+	Sync() error
+	Close() error
+	Name() string
+}
+
+// torrentFS - file-system operations used by saveTorrentFS, allows inject faults in tests
+type torrentFS interface {
+	CreateTemp(dir, pattern string) (torrentFile, error)
+	Rename(oldPath, newPath string) error
+	Remove(name string) error
+	SyncDir(dir string) error
+}
+
+type osFS struct{}
+
+func (osFS) CreateTemp(dir, pattern string) (torrentFile, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.Chmod(0644); err != nil { // CreateTemp uses 0600, but .torrent files are public
+		f.Close()
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+func (osFS) Rename(oldPath, newPath string) error { return os.Rename(oldPath, newPath) }
+func (osFS) Remove(name string) error             { return os.Remove(name) }
+func (osFS) SyncDir(dir string) error {
+	if runtime.GOOS == "windows" { // directories can't be opened for fsync on windows
+		return nil
+	}
+	if dir == "" {
+		dir = "."
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
 // addTorrentFile - adding .torrent file to torrentClient (and checking their hashes), if .torrent file
 // added first time - pieces verification process will start (disk IO heavy) - Progress
 // kept in `piece completion storage` (surviving reboot). Once it done - no disk IO needed again.
@@ -0,0 +1,79 @@
+package downloader
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// faultyFS - wraps real file-system and injects faults
+type faultyFS struct {
+	osFS
+	shortWrite  bool
+	failSyncDir bool
+	renamed     int
+	dirSynced   int
+}
+
+type shortWriteFile struct{ torrentFile }
+
+func (f shortWriteFile) Write(b []byte) (int, error) {
+	if len(b) <= 1 {
+		return 0, nil
+	}
+	return f.torrentFile.Write(b[:len(b)/2])
+}
+
+func (fs *faultyFS) CreateTemp(dir, pattern string) (torrentFile, error) {
+	f, err := fs.osFS.CreateTemp(dir, pattern)
+	if err != nil || !fs.shortWrite {
+		return f, err
+	}
+	return shortWriteFile{f}, nil
+}
+func (fs *faultyFS) Rename(oldPath, newPath string) error {
+	fs.renamed++
+	return fs.osFS.Rename(oldPath, newPath)
+}
+func (fs *faultyFS) SyncDir(dir string) error {
+	if fs.failSyncDir {
+		return errors.New("injected fsync error")
+	}
+	fs.dirSynced++
+	return fs.osFS.SyncDir(dir)
+}
+
+func TestSaveTorrent(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	fPath := filepath.Join(dir, "a.seg.torrent")
+	data := []byte("d4:infod6:lengthi1eee")
+
+	fs := &faultyFS{}
+	require.NoError(saveTorrentFS(fs, fPath, data))
+	require.Equal(1, fs.renamed)
+	require.Equal(1, fs.dirSynced)
+	got, err := os.ReadFile(fPath)
+	require.NoError(err)
+	require.Equal(data, got)
+
+	// short writes: don't leave partial or temp files
+	fPath2 := filepath.Join(dir, "b.seg.torrent")
+	err = saveTorrentFS(&faultyFS{shortWrite: true}, fPath2, data)
+	require.ErrorIs(err, io.ErrShortWrite)
+	require.NoFileExists(fPath2)
+
+	// rename is not durable until parent dir fsync'ed
+	err = saveTorrentFS(&faultyFS{failSyncDir: true}, fPath2, data)
+	require.Error(err)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(err)
+	for _, f := range files {
+		require.NotEqual(".tmp", filepath.Ext(f.Name()))
+	}
+}
@@ -3,29 +3,39 @@ package downloader
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go/logging"
+	"github.com/aws/smithy-go/middleware"
 
 	"github.com/anacrolix/torrent/bencode"
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/c2h5oh/datasize"
 	"github.com/ledgerwatch/erigon-lib/common/dir"
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
 	"github.com/ledgerwatch/erigon-lib/downloader/snaptype"
 	"github.com/ledgerwatch/log/v3"
-	"github.com/pelletier/go-toml/v2"
+	"golang.org/x/exp/slices"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 )
 
 // WebSeeds - allow use HTTP-based infrastrucutre to support Bittorrent network
@@ -33,128 +43,1020 @@ import (
 type WebSeeds struct {
 	lock sync.Mutex
 
-	byFileName          snaptype.WebSeedUrls // HTTP urls of data files
-	torrentUrls         snaptype.TorrentUrls // HTTP urls of .torrent files
+	discoveryLock   sync.Mutex         // only 1 Discover run at a time
+	discoveryCancel context.CancelFunc // of current Discover run, guarded by `lock`
+	resumed         chan struct{}      // not nil while paused (see Pause), guarded by `lock`
+
+	byFileName          snaptype.WebSeedUrls         // HTTP urls of data files
+	sources             map[string][]string          // providers of byFileName urls, same index. Shorter if urls added by Merge
+	torrentUrls         snaptype.TorrentUrls         // HTTP urls of .torrent files
+	lastDiff            WebSeedsDiff                 // byFileName+torrentUrls changes by last Discover
+	infoHashes          map[string]metainfo.Hash     // expected info-hash by data file name, if advertised by manifest
+	sizes               map[string]datasize.ByteSize // by file name (data or .torrent), if advertised by manifest
+	toBlocks            map[string]uint64            // end of block range by data file name, if advertised by manifest
+	priorities          map[string]int64             // by data file name, if advertised by manifest
+	checksums           map[string]*checksum         // by data file name, if advertised by manifest
+	magnets             map[string]metainfo.Magnet   // by data file name, for entries with magnet link instead of url
+	stats               WebSeedsStats
 	downloadTorrentFile bool
 
-	chainName string
+	chainName   string
+	userAgent   string
+	filesFilter []string     // prefixes or snaptype names, empty - all files
+	httpClient  *http.Client // used by all http providers and by s3 client
+
+	fallbackFile    string // overrides embedded fallback manifest
+	disableFallback bool
+
+	shouldDownload           func(name string, mi *metainfo.MetaInfo) bool // nil - download all allowed files
+	torrentConsistencySample float64                                       // share of files with many urls checked for same info-hash
+
+	s3Credentials aws.CredentialsProvider // nil - use static credentials from token
+
+	hostWeights map[string]float64 // used by ByFileNameBalanced, absent host has weight 1
+
+	torrentFS      torrentFS                              // where .torrent files are saved, allows inject faults in tests
+	diskCapacityOf func(dir string) (diskCapacity, error) // of filesystem with .torrent files, allows inject in tests
+
+	hostLimiters  map[string]*rate.Limiter // advertised by providers in manifest
+	globalLimiter *rate.Limiter            // used for hosts without advertised limit, nil - unlimited
+
+	providerTimeBudget downloadercfg.ProviderTimeBudget
+	providerTimeout    time.Duration // hard cap of 1 provider call, 0 - no cap
+	providerMinTimeout time.Duration // lower bound of slice given by ProviderTimeBudgetEqualSlice
+
+	torrentHeadPreflight bool                // HEAD .torrent url before GET
+	noHeadHosts          map[string]struct{} // hosts which don't support HEAD
+
+	disableS3 bool // never build s3 client, ignore s3 tokens
+
+	sshKeyFile    string // private key for sftp providers
+	sshKnownHosts string // empty - ~/.ssh/known_hosts
+	gitToken      string // for git+https providers
+
+	mergeStrategy downloadercfg.ManifestMergeStrategy
+
+	strictSchema bool // reject manifests of newer schema_version
+
+	torrentsBySize bool // download small .torrent files first
+
+	hostOverrides map[string]string // url host -> `Host` header (and TLS SNI, see hostOverrideTransport)
+
+	allowedHosts *hostAllowlist // nil - all hosts allowed
+	// checkTorrentUrls - apply allowedHosts also to urls inside downloaded .torrent files
+	checkTorrentUrls bool
+
+	reportWriter io.Writer        // nil - no reports
+	report       *DiscoveryReport // of current Discover run, guarded by `lock`
+
+	torrentsIndex bool // persist set of present .torrent files between restarts
+
+	byteBudget datasize.ByteSize // per Discover run, 0 - no cap
+	bytesUsed  uint64            // by current Discover run, guarded by `lock`
+
+	latency map[string]*hostLatency // by host, of current Discover run, guarded by `lock`
+
+	torrentsETag bool          // track ETag of .torrent files
+	etags        *torrentETags // of current Discover run, nil - not tracked
+
+	skipTorrent func(name string) bool // never nil
+
+	verifyChecksum bool // of files downloaded by DownloadFile, by sidecar .checksum
+
+	s3Endpoint *downloadercfg.S3Endpoint // of own chain, nil - global R2
+
+	sizeConsistencySample float64 // share of files with many urls HEAD-ed for same size
+
+	skipLogLevel log.Lvl
+	skipped      map[string]struct{} // name+reason logged by current Discover run, guarded by `lock`
+
+	requestLimiter      *rate.Limiter            // all hosts, nil - unlimited
+	hostRequestRate     float64                  // <=0 - unlimited
+	hostRequestLimiters map[string]*rate.Limiter // by host, created on first request, guarded by `lock`
+
+	freshnessCheck downloadercfg.FreshnessCheck
+	latestMarkers  map[string]string // provider url -> url of its latest marker
+
+	s3ChecksumValidation downloadercfg.S3ChecksumValidation
+
+	requireHTTPS bool
+
+	weightDecay, weightRecovery float64
+	adaptiveWeights             map[string]float64 // by url host (with port), absent - 1. Guarded by `lock`
+
+	capabilityProbe bool
+	capabilities    map[string]ProviderCapabilities // by url host, guarded by `lock`
+
+	classifier snaptype.FileClassifier
+
+	cutoffBlock uint64
+
+	retries      int
+	retryBackoff time.Duration // of first retry, doubled for each next one
+	isRetryable  func(resp *http.Response, err error) bool
+
+	recentErrors *recentErrors // guarded by `lock`
+
+	providers *webSeedProviders // of DiscoverConfigured, guarded by `lock`
+
+	maxManifestEntries, maxTotalEntries int // <=0 - no limit
+
+	torrentsMaxDuration time.Duration // 0 - no cap
+
+	s3MaxManifestAge time.Duration // 0 - no check
+
+	minSuccessfulProviders int
+
+	expectedHosts      *hostPatterns // nil - any host expected, guarded by `lock`
+	expectedHostsCheck downloadercfg.ExpectedHostsCheck
+
+	manifestResumes       int   // 0 - large manifests are not resumed
+	manifestResumeMinSize int64 // smaller manifests are decoded from body
+
+	providerVerbosity map[string]log.Lvl // by host, overrides `verbosity` and `trace`
+
 	logger    log.Logger
 	verbosity log.Lvl
+	trace     bool // log metadata of each request/response to providers
+}
+
+func NewWebSeeds(cfg *downloadercfg.Cfg, logger log.Logger, verbosity log.Lvl) (*WebSeeds, error) {
+	httpClient, err := newWebSeedHttpClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	allowedHosts, err := parseHostAllowlist(cfg.WebSeedAllowedHosts)
+	if err != nil {
+		return nil, err
+	}
+	httpClient.CheckRedirect = checkRedirect(allowedHosts, cfg.WebSeedRequireHTTPS)
+	expectedHosts, err := parseHostPatterns(cfg.WebSeedExpectedHosts)
+	if err != nil {
+		return nil, err
+	}
+	var s3Credentials aws.CredentialsProvider
+	if cfg.WebSeedS3Credentials != nil {
+		s3Credentials = aws.NewCredentialsCache(cfg.WebSeedS3Credentials)
+	}
+	if cfg.WebSeedProxy != "" {
+		proxyUrl, _ := parseProxyUrl(cfg.WebSeedProxy) // validated by newWebSeedHttpClient
+		logger.Info("[snapshots] webseed requests go through proxy", "proxy", redactUrl(proxyUrl))
+	}
+	s3Endpoint, err := s3EndpointOf(cfg.WebSeedS3Endpoints, cfg.ChainName)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAdaptiveWeights(cfg.WebSeedWeightDecay, cfg.WebSeedWeightRecovery); err != nil {
+		return nil, err
+	}
+	if err := checkS3EndpointHTTPS(cfg.WebSeedRequireHTTPS, s3Endpoint); err != nil {
+		return nil, err
+	}
+	classifier := cfg.WebSeedFileClassifier
+	if classifier == nil {
+		classifier = snaptype.DefaultFileClassifier
+	}
+	skipTorrent := cfg.WebSeedSkipTorrent
+	if skipTorrent == nil {
+		skipTorrent = func(name string) bool { return skipUnsupportedTorrent(classifier, name) }
+	}
+	d := &WebSeeds{
+		s3Credentials:            s3Credentials,
+		downloadTorrentFile:      cfg.DownloadTorrentFilesFromWebseed || (cfg.SnapStop && cfg.WebSeedTorrentsWhenSnapStop),
+		chainName:                cfg.ChainName,
+		filesFilter:              cfg.WebSeedFilesFilter,
+		shouldDownload:           cfg.WebSeedShouldDownload,
+		torrentConsistencySample: cfg.WebSeedTorrentConsistencySample,
+		userAgent:                cfg.WebSeedUserAgent,
+		httpClient:               httpClient,
+		fallbackFile:             cfg.WebSeedFallbackFile,
+		disableFallback:          cfg.WebSeedDisableFallback,
+		hostWeights:              cfg.WebSeedHostWeights,
+		torrentFS:                osFS{},
+		diskCapacityOf:           getDiskCapacity,
+		globalLimiter:            globalDownloadLimiter(cfg),
+		providerTimeBudget:       cfg.WebSeedProviderTimeBudget,
+		providerTimeout:          cfg.WebSeedProviderTimeout,
+		providerMinTimeout:       cfg.WebSeedProviderMinTimeout,
+		torrentHeadPreflight:     cfg.WebSeedTorrentHeadPreflight,
+		disableS3:                cfg.WebSeedDisableS3,
+		sshKeyFile:               cfg.WebSeedSSHKeyFile,
+		sshKnownHosts:            cfg.WebSeedSSHKnownHosts,
+		mergeStrategy:            cfg.WebSeedMergeStrategy,
+		strictSchema:             cfg.WebSeedStrictSchema,
+		torrentsBySize:           cfg.WebSeedTorrentsBySize,
+		hostOverrides:            cfg.WebSeedHostOverrides,
+		allowedHosts:             allowedHosts,
+		reportWriter:             cfg.WebSeedDiscoveryReport,
+		torrentsIndex:            cfg.WebSeedTorrentsIndex,
+		byteBudget:               cfg.WebSeedDiscoveryByteBudget,
+		torrentsETag:             cfg.WebSeedTorrentsETag,
+		skipTorrent:              skipTorrent,
+		verifyChecksum:           cfg.WebSeedVerifyChecksum,
+		s3Endpoint:               s3Endpoint,
+		sizeConsistencySample:    cfg.WebSeedSizeConsistencySample,
+		skipLogLevel:             skipLogLevel(cfg.WebSeedSkipLogLevel),
+		requestLimiter:           newRequestLimiter(cfg.WebSeedRequestRate, defaultWebSeedRequestRate),
+		hostRequestRate:          requestRateOrDefault(cfg.WebSeedHostRequestRate, defaultWebSeedHostRequestRate),
+		freshnessCheck:           cfg.WebSeedFreshnessCheck,
+		latestMarkers:            cfg.WebSeedLatestMarkers,
+		s3ChecksumValidation:     cfg.WebSeedS3ChecksumValidation,
+		requireHTTPS:             cfg.WebSeedRequireHTTPS,
+		weightDecay:              cfg.WebSeedWeightDecay,
+		weightRecovery:           weightRecoveryOrDefault(cfg.WebSeedWeightRecovery),
+		capabilityProbe:          cfg.WebSeedCapabilityProbe,
+		classifier:               classifier,
+		cutoffBlock:              cfg.WebSeedTorrentsCutoffBlock,
+		retries:                  cfg.WebSeedRetries,
+		retryBackoff:             defaultRetryBackoff,
+		isRetryable:              isRetryableOrDefault(cfg.WebSeedIsRetryable),
+		recentErrors:             newRecentErrors(cfg.WebSeedRecentErrors),
+		checkTorrentUrls:         cfg.WebSeedCheckTorrentUrls,
+		providers:                newWebSeedProviders(cfg.WebSeedS3Tokens, cfg.WebSeedUrls, cfg.WebSeedFiles),
+		maxManifestEntries:       limitOrDefault(cfg.WebSeedMaxManifestEntries, defaultMaxManifestEntries),
+		maxTotalEntries:          limitOrDefault(cfg.WebSeedMaxTotalEntries, defaultMaxTotalEntries),
+		torrentsMaxDuration:      cfg.WebSeedTorrentsMaxDuration,
+		gitToken:                 cfg.WebSeedGitToken,
+		s3MaxManifestAge:         cfg.WebSeedS3MaxManifestAge,
+		minSuccessfulProviders:   limitOrDefault(cfg.WebSeedMinSuccessfulProviders, 1),
+		expectedHosts:            expectedHosts,
+		expectedHostsCheck:       cfg.WebSeedExpectedHostsCheck,
+		manifestResumes:          limitOrDefault(cfg.WebSeedManifestResumes, defaultManifestResumes),
+		manifestResumeMinSize:    int64(resumableManifestMinSize.Bytes()),
+		providerVerbosity:        newProviderVerbosity(cfg.WebSeedProviderVerbosity),
+		logger:                   logger,
+		verbosity:                verbosity,
+		trace:                    cfg.WebSeedTrace,
+	}
+	if cfg.Dirs.Snap != "" { // leftovers of crash or kill: Discover cleans staging only when it has .torrent files to download
+		if err := removeTorrentsStaging(cfg.Dirs.Snap); err != nil {
+			logger.Warn("[snapshots] remove webseed staging dir", "dir", cfg.Dirs.Snap, "err", err)
+		}
+	}
+	return d, nil
 }
 
+// Discover - on ctx cancellation returns only after in-flight .torrent saves completed,
+// and because saves are atomic - no partial .torrent files left on disk.
+//
+// Ordering guarantees:
+//   - runs are serialized: Discover called during another run waits until that run returned
+//   - discovered urls are published all at once, after all providers answered. Cancelled run publishes nothing:
+//     readers see urls of previous completed run
+//   - .torrent files are fetched only after urls published, cancellation stops new fetches and saves
+//   - while paused (see Pause) it doesn't start new work
 func (d *WebSeeds) Discover(ctx context.Context, s3tokens []string, urls []*url.URL, files []string, rootDir string) {
-	d.downloadWebseedTomlFromProviders(ctx, s3tokens, urls, files)
+	_ = d.discover(ctx, &webSeedProviders{s3tokens: s3tokens, urls: urls, files: files}, rootDir)
+}
+
+// DiscoverAsync - Discover in background, caller may do other init work meanwhile. Channel receives 1 value when run returned
+// and is closed: nil if run completed, or error of cancellation (by ctx or CancelDiscovery) or ErrNotEnoughProviders - then,
+// as with Discover, result of previous completed run is kept. Runs are serialized same way as Discover: async run started while other run
+// is in progress begins after it
+func (d *WebSeeds) DiscoverAsync(ctx context.Context, s3tokens []string, urls []*url.URL, files []string, rootDir string) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		defer close(done)
+		done <- d.discover(ctx, &webSeedProviders{s3tokens: s3tokens, urls: urls, files: files}, rootDir)
+	}()
+	return done
+}
+
+// discover - nil `providers`: current set of SetProviders
+func (d *WebSeeds) discover(ctx context.Context, providers *webSeedProviders, rootDir string) error {
+	d.discoveryLock.Lock()
+	defer d.discoveryLock.Unlock()
+	if providers == nil {
+		d.lock.Lock()
+		providers = d.providers
+		d.lock.Unlock()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	d.lock.Lock()
+	d.discoveryCancel = cancel
+	d.lock.Unlock()
+	defer func() {
+		d.lock.Lock()
+		d.discoveryCancel = nil
+		d.lock.Unlock()
+	}()
+	if err := d.waitResumed(ctx); err != nil {
+		return err
+	}
+	d.startReport()
+	d.resetByteBudget()
+	d.resetSkipped()
+
+	if err := d.downloadWebseedTomlFromProviders(ctx, providers.s3tokens, providers.urls, providers.files); err != nil {
+		d.finishLatency()
+		d.finishReport(ctx)
+		return err
+	}
 	d.downloadTorrentFilesFromProviders(ctx, rootDir)
+	d.checkSizeConsistency(ctx)
+	d.countMissingTorrents(rootDir)
+	d.finishLatency()
+	d.finishReport(ctx)
+	return ctx.Err()
+}
+
+// CancelDiscovery - aborts current Discover run (if any) and waits until it returned.
+// After it: state of previous completed run, and new Discover can be started (for example, with new providers).
+func (d *WebSeeds) CancelDiscovery() {
+	d.lock.Lock()
+	cancel := d.discoveryCancel
+	d.lock.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	d.discoveryLock.Lock()
+	defer d.discoveryLock.Unlock()
+}
+
+// downloadWebseedTomlFromProviders - error if nothing published: cancelled, or not enough providers succeeded
+func (d *WebSeeds) downloadWebseedTomlFromProviders(ctx context.Context, s3Providers []string, httpProviders []*url.URL, diskProviders []string) error {
+	fetched, err := d.fetchManifests(ctx, s3Providers, httpProviders, diskProviders)
+	if err != nil {
+		return err
+	}
+	list := fetched.list
+	m := d.mergeRun(list)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.lastDiff = diffWebSeeds(d.byFileName, m.webSeedUrls, d.torrentUrls, m.torrentUrls)
+	for _, manifest := range list {
+		d.applyRateLimitHints(manifest)
+	}
+	d.byFileName = m.webSeedUrls
+	d.sources = m.sources
+	d.torrentUrls = m.torrentUrls
+	d.infoHashes = m.infoHashes
+	d.sizes = m.sizes
+	d.toBlocks = m.toBlocks
+	d.priorities = m.priorities
+	d.checksums = m.checksums
+	d.stats.ProviderEntries = m.entries
+	d.magnets = m.magnets
+	return nil
+}
+
+// fetchedManifests - result of fetchManifests
+type fetchedManifests struct {
+	list      []*webSeedManifest // valid manifests, in order of providers
+	providers []string           // names of all called providers, in order
+	failed    map[string]error   // by provider name. Providers neither in `list` nor here - manifest rejected by validation
 }
 
-func (d *WebSeeds) downloadWebseedTomlFromProviders(ctx context.Context, s3Providers []string, httpProviders []*url.URL, diskProviders []string) {
+// fetchManifests - calls providers and validates their manifests. Doesn't publish anything.
+// Error if cancelled or not enough providers succeeded
+func (d *WebSeeds) fetchManifests(ctx context.Context, s3Providers []string, httpProviders []*url.URL, diskProviders []string) (*fetchedManifests, error) {
+	if d.disableS3 && len(s3Providers) > 0 {
+		d.logger.Warn("[snapshots] s3 webseed providers are disabled by config, ignoring them", "s3", len(s3Providers))
+		s3Providers = nil
+	}
+	configured := len(s3Providers) + len(httpProviders) + len(diskProviders)
+	s3Providers, httpProviders, diskProviders = d.dedupProviders(s3Providers, httpProviders, diskProviders)
+	s3Providers, httpProviders = d.secureProviders(s3Providers, httpProviders)
+	d.probeProviders(ctx, httpProviders)
 	log.Debug("[snapshots] webseed providers", "http", len(httpProviders), "s3", len(s3Providers), "disk", len(diskProviders))
-	list := make([]snaptype.WebSeedsFromProvider, 0, len(httpProviders)+len(diskProviders))
-	for _, webSeedProviderURL := range httpProviders {
-		select {
-		case <-ctx.Done():
+	list := make([]*webSeedManifest, 0, len(httpProviders)+len(diskProviders))
+	res := &fetchedManifests{failed: map[string]error{}}
+	networkProviders := len(httpProviders) + len(s3Providers)
+	for i, webSeedProviderURL := range httpProviders {
+		if ctx.Err() != nil {
 			break
-		default:
 		}
-		response, err := d.callHttpProvider(ctx, webSeedProviderURL)
+		providerCtx, cancel := d.providerCtx(ctx, networkProviders-i)
+		response, err := d.callUrlProvider(providerCtx, webSeedProviderURL)
+		cancel()
+		res.providers = append(res.providers, redactUrl(webSeedProviderURL))
 		if err != nil { // don't fail on error
-			d.logger.Debug("[snapshots] downloadWebseedTomlFromProviders", "err", err, "url", webSeedProviderURL.EscapedPath())
+			res.failed[redactUrl(webSeedProviderURL)] = err
+			d.countProviderErr(redactUrl(webSeedProviderURL), err)
+			d.logRequest(webSeedProviderURL, "[snapshots] downloadWebseedTomlFromProviders", "err", err, "url", webSeedProviderURL.EscapedPath())
 			continue
 		}
+		d.countProviderOk()
+		response.provider = redactUrl(webSeedProviderURL)
 		list = append(list, response)
 	}
-	for _, webSeedProviderURL := range s3Providers {
-		select {
-		case <-ctx.Done():
+	for i, webSeedProviderURL := range s3Providers {
+		if ctx.Err() != nil {
 			break
-		default:
 		}
-		response, err := d.callS3Provider(ctx, webSeedProviderURL)
+		providerCtx, cancel := d.providerCtx(ctx, networkProviders-len(httpProviders)-i)
+		response, err := d.callS3Provider(providerCtx, webSeedProviderURL)
+		cancel()
+		res.providers = append(res.providers, d.s3ProviderName(webSeedProviderURL))
 		if err != nil { // don't fail on error
-			d.logger.Debug("[snapshots] downloadWebseedTomlFromProviders", "err", err, "url", "s3")
+			res.failed[d.s3ProviderName(webSeedProviderURL)] = err
+			d.countProviderErr(d.s3ProviderName(webSeedProviderURL), err)
+			d.logRequest(d.s3ProviderUrl(webSeedProviderURL), "[snapshots] downloadWebseedTomlFromProviders", "err", err, "provider", d.s3ProviderName(webSeedProviderURL))
 			continue
 		}
+		d.countProviderOk()
+		response.provider = d.s3ProviderName(webSeedProviderURL)
 		list = append(list, response)
 	}
 	// add to list files from disk
-	for _, webSeedFile := range diskProviders {
-		response, err := d.readWebSeedsFile(webSeedFile)
+	responses, errs := d.readWebSeedsFiles(diskProviders)
+	for i, webSeedFile := range diskProviders {
+		response, err := responses[i], errs[i]
+		res.providers = append(res.providers, webSeedFile)
 		if err != nil { // don't fail on error
+			res.failed[webSeedFile] = err
+			d.countProviderErr(webSeedFile, err)
 			_, fileName := filepath.Split(webSeedFile)
-			d.logger.Debug("[snapshots] downloadWebseedTomlFromProviders", "err", err, "file", fileName)
+			d.logRequest(&url.URL{Scheme: "file", Path: webSeedFile}, "[snapshots] downloadWebseedTomlFromProviders", "err", err, "file", fileName)
 			continue
 		}
 		if len(diskProviders) > 0 {
 			d.logger.Log(d.verbosity, "[snapshots] see webseed.toml file", "files", webSeedFile)
 		}
+		d.countProviderOk()
+		response.provider = webSeedFile
 		list = append(list, response)
 	}
+	list = d.filterBySchemaVersion(list)
+	list = d.filterByChain(list)
+	list = d.filterByEntryCount(list)
+	list = d.filterByMaxEntries(list)
+	if isEmptyManifests(list) {
+		response, err := d.fallbackManifest()
+		if err != nil {
+			d.logger.Debug("[snapshots] downloadWebseedTomlFromProviders", "err", err, "provider", "fallback")
+		} else if response != nil && len(response.files) > 0 {
+			d.logger.Log(d.verbosity, "[snapshots] no webseed providers available, use fallback manifest", "files", len(response.files))
+			response.provider = "fallback"
+			list = append(list, response)
+		}
+	}
 
-	webSeedUrls, torrentUrls := snaptype.WebSeedUrls{}, snaptype.TorrentUrls{}
-	for _, urls := range list {
-		for name, wUrl := range urls {
+	res.list = list
+
+	if ctx.Err() != nil { // cancelled in the middle: list is incomplete, keep result of previous run
+		return res, ctx.Err()
+	}
+	if configured > 0 && len(list) < d.minSuccessfulProviders { // keep result of previous run. No providers configured - nothing to require
+		d.logger.Warn("[snapshots] not enough webseed providers returned valid manifest, discovered files not updated",
+			"ok", len(list), "required", d.minSuccessfulProviders)
+		return res, fmt.Errorf("%w: %d of required %d", ErrNotEnoughProviders, len(list), d.minSuccessfulProviders)
+	}
+	return res, nil
+}
+
+// mergeRun - mergeManifests with expected hosts of this run, warns about dropped urls
+func (d *WebSeeds) mergeRun(list []*webSeedManifest) *mergedManifests {
+	m := newMergedManifests(list)
+	d.lock.Lock()
+	m.expectedHosts = d.expectedHosts
+	d.lock.Unlock()
+	m = d.mergeManifests(m, list)
+	if m.notAllowed > 0 {
+		d.logger.Warn("[snapshots] webseed manifest has urls of not allowed hosts, dropped them (possible SSRF attempt)", "amount", m.notAllowed)
+	}
+	if m.insecure > 0 {
+		d.logger.Warn("[snapshots] https required, dropped plain http webseed urls", "amount", m.insecure)
+	}
+	if m.unexpectedHost > 0 {
+		d.logger.Warn("[snapshots] webseed manifest has urls of unexpected hosts", "amount", m.unexpectedHost, "expected", m.expectedHosts.patterns,
+			"dropped", d.expectedHostsCheck != downloadercfg.ExpectedHostsWarn)
+	}
+	if m.expired > 0 {
+		d.logger.Log(d.verbosity, "[snapshots] dropped expired webseed urls", "amount", m.expired)
+	}
+	return m
+}
+
+// mergedManifests - result of mergeManifests: what downloadWebseedTomlFromProviders publishes, and counters of dropped urls
+type mergedManifests struct {
+	webSeedUrls snaptype.WebSeedUrls
+	sources     map[string][]string // providers of webSeedUrls: sources[name][i] listed webSeedUrls[name][i]
+	torrentUrls snaptype.TorrentUrls
+	infoHashes  map[string]metainfo.Hash
+	sizes       map[string]datasize.ByteSize
+	toBlocks    map[string]uint64
+	priorities  map[string]int64
+	checksums   map[string]*checksum
+	magnets     map[string]metainfo.Magnet
+	entries     map[string]int // by provider
+
+	expectedHosts *hostPatterns // of this run
+
+	expired, notAllowed, insecure, unexpectedHost int
+}
+
+// newMergedManifests - maps pre-sized by biggest manifest: providers usually list mostly same files,
+// so it's close to final size and large catalogs are not re-hashed many times while growing
+func newMergedManifests(list []*webSeedManifest) *mergedManifests {
+	var biggest *webSeedManifest
+	for _, manifest := range list {
+		if biggest == nil || len(manifest.files) > len(biggest.files) {
+			biggest = manifest
+		}
+	}
+	var files, torrents, metas int
+	if biggest != nil {
+		for name := range biggest.files {
+			if strings.HasSuffix(name, ".torrent") {
+				torrents++
+			}
+		}
+		files, metas = len(biggest.files)-torrents, len(biggest.meta)
+	}
+	return &mergedManifests{
+		webSeedUrls: make(snaptype.WebSeedUrls, files),
+		sources:     make(map[string][]string, files),
+		torrentUrls: make(snaptype.TorrentUrls, torrents),
+		infoHashes:  make(map[string]metainfo.Hash, metas),
+		sizes:       make(map[string]datasize.ByteSize, metas),
+		toBlocks:    map[string]uint64{},
+		priorities:  map[string]int64{},
+		checksums:   map[string]*checksum{},
+		magnets:     map[string]metainfo.Magnet{},
+		entries:     make(map[string]int, len(list)),
+	}
+}
+
+func (d *WebSeeds) mergeManifests(m *mergedManifests, list []*webSeedManifest) *mergedManifests {
+	now := time.Now()
+	for _, manifest := range list {
+		for name, wUrl := range manifest.files {
+			if !d.matchFilesFilter(name) {
+				d.logSkip(name, SkipFilesFilter)
+				continue
+			}
+			if expiresAt := manifest.expiresAt(name); !expiresAt.IsZero() && now.After(expiresAt) { // signed url likely expired: torrent client would get 403
+				m.expired++
+				d.logSkip(name, SkipExpired, "expires", expiresAt)
+				continue
+			}
+			if d.mergeStrategy == downloadercfg.ManifestMergeFillGaps && (len(m.webSeedUrls[name]) > 0 || len(m.torrentUrls[name]) > 0) { // already listed by previous provider
+				d.logSkip(name, SkipListedBefore)
+				continue
+			}
+			if meta, ok := manifest.meta[name]; ok {
+				if meta.infoHash != nil {
+					m.infoHashes[strings.TrimSuffix(name, ".torrent")] = *meta.infoHash
+				}
+				if meta.size > 0 {
+					m.sizes[name] = meta.size
+				}
+				if meta.toBlock > 0 {
+					m.toBlocks[strings.TrimSuffix(name, ".torrent")] = meta.toBlock
+				}
+				if meta.priority != nil {
+					m.priorities[priorityKey(name)] = *meta.priority
+				}
+				if meta.checksum != nil {
+					m.checksums[name] = meta.checksum
+				}
+			}
+			if isMagnet(wUrl) { // has no host, not downloaded by http
+				magnet, err := metainfo.ParseMagnetUri(wUrl)
+				if err != nil {
+					d.logSkip(name, SkipInvalidUrl, "err", err)
+					continue
+				}
+				if _, ok := m.magnets[magnetKey(name)]; !ok {
+					m.magnets[magnetKey(name)] = magnet
+					m.entries[manifest.provider]++
+				}
+				continue
+			}
+			if !d.allowedHosts.allowedUrl(wUrl) {
+				m.notAllowed++
+				d.logSkip(name, SkipHostNotAllowed, "url", wUrl)
+				continue
+			}
+			if d.requireHTTPS && !secureRawUrl(wUrl) {
+				m.insecure++
+				d.logSkip(name, SkipInsecureUrl, "url", wUrl)
+				continue
+			}
+			if d.unexpectedHost(m, name, wUrl, manifest.provider) {
+				continue
+			}
 			if strings.HasSuffix(name, ".torrent") {
 				uri, err := url.ParseRequestURI(wUrl)
 				if err != nil {
-					d.logger.Debug("[snapshots] url is invalid", "url", wUrl, "err", err)
+					d.logSkip(name, SkipInvalidUrl, "err", err)
 					continue
 				}
-				torrentUrls[name] = append(torrentUrls[name], uri)
+				m.torrentUrls[name] = append(m.torrentUrls[name], uri)
+				m.entries[manifest.provider]++
 				continue
 			}
-			webSeedUrls[name] = append(webSeedUrls[name], wUrl)
+			m.webSeedUrls[name] = append(m.webSeedUrls[name], wUrl)
+			m.sources[name] = append(m.sources[name], manifest.provider)
+			m.entries[manifest.provider]++
 		}
 	}
+	return m
+}
 
+// filterBySchemaVersion - manifest of newer schema may have fields with meaning this node doesn't know.
+// By default only known fields are used (lenient), in strict mode such manifest ignored.
+func (d *WebSeeds) filterBySchemaVersion(list []*webSeedManifest) []*webSeedManifest {
+	res := list[:0]
+	for _, manifest := range list {
+		if manifest.schemaVersion > webSeedsSchemaVersion {
+			if d.strictSchema {
+				d.logger.Warn("[snapshots] webseed manifest has unsupported schema_version, ignoring it", "version", manifest.schemaVersion, "supported", webSeedsSchemaVersion)
+				continue
+			}
+			d.logger.Warn("[snapshots] webseed manifest has newer schema_version, using only known fields", "version", manifest.schemaVersion, "supported", webSeedsSchemaVersion)
+		}
+		res = append(res, manifest)
+	}
+	return res
+}
+
+// filterByChain - manifest declared other chain: almost certainly misconfiguration (for example, mainnet node pointed to goerli webseeds)
+func (d *WebSeeds) filterByChain(list []*webSeedManifest) []*webSeedManifest {
+	res := list[:0]
+	for _, manifest := range list {
+		if manifest.chain != "" && d.chainName != "" && manifest.chain != d.chainName {
+			d.logger.Warn("[snapshots] webseed manifest is for other chain, check webseed providers config. Ignoring it", "manifest_chain", manifest.chain, "chain", d.chainName)
+			continue
+		}
+		res = append(res, manifest)
+	}
+	return res
+}
+
+// filterByEntryCount - manifest cut short (in transit or by producer) may still be valid TOML: compare with declared amount
+func (d *WebSeeds) filterByEntryCount(list []*webSeedManifest) []*webSeedManifest {
+	res := list[:0]
+	for _, manifest := range list {
+		if manifest.entries > 0 && manifest.entries != int64(len(manifest.files)) {
+			d.logger.Warn("[snapshots] webseed manifest has unexpected amount of entries, ignoring it", "provider", manifest.provider,
+				"expected", manifest.entries, "actual", len(manifest.files))
+			continue
+		}
+		res = append(res, manifest)
+	}
+	return res
+}
+
+// filterByMaxEntries - runaway or malicious provider must not exhaust memory of merge. Providers are counted in order:
+// manifest which doesn't fit into what's left of total limit is ignored, next (smaller) ones still may fit
+func (d *WebSeeds) filterByMaxEntries(list []*webSeedManifest) []*webSeedManifest {
+	res := list[:0]
+	total := 0
+	for _, manifest := range list {
+		if d.maxManifestEntries > 0 && len(manifest.files) > d.maxManifestEntries {
+			d.logger.Warn("[snapshots] webseed manifest has too many entries, ignoring it", "provider", manifest.provider,
+				"entries", len(manifest.files), "limit", d.maxManifestEntries)
+			continue
+		}
+		if d.maxTotalEntries > 0 && total+len(manifest.files) > d.maxTotalEntries {
+			d.logger.Warn("[snapshots] webseed manifests have too many entries in total, ignoring manifest", "provider", manifest.provider,
+				"entries", len(manifest.files), "total", total, "limit", d.maxTotalEntries)
+			continue
+		}
+		total += len(manifest.files)
+		res = append(res, manifest)
+	}
+	return res
+}
+
+func isEmptyManifests(list []*webSeedManifest) bool {
+	for _, l := range list {
+		if len(l.files) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// WebSeedsDiff - changes of discovered files between 2 last Discover runs. Names are sorted.
+type WebSeedsDiff struct {
+	Added   []string // files which were not discovered by previous run
+	Removed []string // files which are not discovered anymore
+	Changed []string // files with changed set of urls
+}
+
+func (d WebSeedsDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// LastDiff - what changed by last Discover. Allows process only changes instead of whole catalog.
+func (d *WebSeeds) LastDiff() WebSeedsDiff {
 	d.lock.Lock()
 	defer d.lock.Unlock()
-	d.byFileName = webSeedUrls
-	d.torrentUrls = torrentUrls
+	return d.lastDiff
+}
+
+// WebSeedsReconcile - discrepancies between discovered files and files known by torrent client. Names are sorted,
+// without .torrent suffix: file discovered by data url or by .torrent url is same file
+type WebSeedsReconcile struct {
+	NotInClient   []string // discovered, but torrent client doesn't know them
+	NotDiscovered []string // torrent client knows them, but no provider has them
+}
+
+func (r WebSeedsReconcile) Empty() bool {
+	return len(r.NotInClient) == 0 && len(r.NotDiscovered) == 0
+}
+
+// Reconcile - read-only diagnostic: compares result of last Discover with `known` - names of files torrent client has
+func (d *WebSeeds) Reconcile(known []string) (r WebSeedsReconcile) {
+	d.lock.Lock()
+	discovered := make(map[string]struct{}, len(d.byFileName)+len(d.torrentUrls))
+	for name := range d.byFileName {
+		discovered[strings.TrimSuffix(name, ".torrent")] = struct{}{}
+	}
+	for name := range d.torrentUrls {
+		discovered[strings.TrimSuffix(name, ".torrent")] = struct{}{}
+	}
+	d.lock.Unlock()
+
+	inClient := make(map[string]struct{}, len(known))
+	for _, name := range known {
+		name = strings.TrimSuffix(name, ".torrent")
+		inClient[name] = struct{}{}
+		if _, ok := discovered[name]; !ok {
+			r.NotDiscovered = append(r.NotDiscovered, name)
+		}
+	}
+	for name := range discovered {
+		if _, ok := inClient[name]; !ok {
+			r.NotInClient = append(r.NotInClient, name)
+		}
+	}
+	slices.Sort(r.NotInClient)
+	slices.Sort(r.NotDiscovered)
+	r.NotDiscovered = slices.Compact(r.NotDiscovered) // `known` may have both a.seg and a.seg.torrent
+	return r
+}
+
+func diffWebSeeds(prevFiles, files snaptype.WebSeedUrls, prevTorrents, torrents snaptype.TorrentUrls) (diff WebSeedsDiff) {
+	prev := make(map[string][]string, len(prevFiles)+len(prevTorrents))
+	for name, urls := range prevFiles {
+		prev[name] = urls
+	}
+	for name, urls := range prevTorrents {
+		prev[name] = urlsToStrings(urls)
+	}
+	cur := make(map[string][]string, len(files)+len(torrents))
+	for name, urls := range files {
+		cur[name] = urls
+	}
+	for name, urls := range torrents {
+		cur[name] = urlsToStrings(urls)
+	}
+	for name, urls := range cur {
+		prevUrls, ok := prev[name]
+		if !ok {
+			diff.Added = append(diff.Added, name)
+			continue
+		}
+		if !sameUrlSet(prevUrls, urls) {
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	for name := range prev {
+		if _, ok := cur[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	slices.Sort(diff.Added)
+	slices.Sort(diff.Removed)
+	slices.Sort(diff.Changed)
+	return diff
+}
+
+func urlsToStrings(urls []*url.URL) []string {
+	res := make([]string, len(urls))
+	for i, u := range urls {
+		res[i] = u.String()
+	}
+	return res
+}
+
+// sameUrlSet - order of urls depends on order of providers, it's not a change
+func sameUrlSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+const orderedTorrentDownloadWorkers = 16
+
+// outdatedTorrent - manifest advertises other info-hash than .torrent on disk has (new version of snapshot): need re-download
+func (d *WebSeeds) outdatedTorrent(tPath string, expected metainfo.Hash, hasExpected bool) bool {
+	if !hasExpected {
+		return false
+	}
+	data, err := os.ReadFile(tPath)
+	if err != nil {
+		return false
+	}
+	hash, err := torrentInfoHash(data)
+	if err != nil || hash == expected {
+		return false
+	}
+	d.logger.Log(d.verbosity, "[snapshots] info-hash of .torrent file changed in manifest, re-download it", "file", filepath.Base(tPath), "old", hash.HexString(), "new", expected.HexString())
+	return true
+}
+
+// torrentsDownloadOrder - by default arbitrary (map order). With `torrentsBySize`: ascending by size of .torrent file,
+// or by size of data file if size of .torrent unknown. Files of unknown size - last.
+func (d *WebSeeds) torrentsDownloadOrder(urlsByName snaptype.TorrentUrls) []string {
+	names := make([]string, 0, len(urlsByName))
+	for name := range urlsByName {
+		names = append(names, name)
+	}
+	if !d.torrentsBySize {
+		return names
+	}
+	d.lock.Lock()
+	sizes := d.sizes
+	d.lock.Unlock()
+	sizeOf := func(name string) (datasize.ByteSize, bool) {
+		if size, ok := sizes[name]; ok {
+			return size, true
+		}
+		size, ok := sizes[strings.TrimSuffix(name, ".torrent")]
+		return size, ok
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		si, iok := sizeOf(names[i])
+		sj, jok := sizeOf(names[j])
+		if iok != jok {
+			return iok
+		}
+		if si != sj {
+			return si < sj
+		}
+		return names[i] < names[j]
+	})
+	return names
 }
 
 // downloadTorrentFilesFromProviders - if they are not exist on file-system
 func (d *WebSeeds) downloadTorrentFilesFromProviders(ctx context.Context, rootDir string) {
 	// TODO: need more tests, need handle more forward-compatibility and backward-compatibility case
 	//  - now, if add new type of .torrent files to S3 bucket - existing nodes will start downloading it. maybe need whitelist of file types
-	//  - maybe need download new files if --snap.stop=true
 	if !d.downloadTorrentFile {
 		return
 	}
 	if len(d.TorrentUrls()) == 0 {
 		return
 	}
-	var addedNew int
+	var addedNew, skipped int
+	var pending []string // to download, in order
 	e, ctx := errgroup.WithContext(ctx)
 	urlsByName := d.TorrentUrls()
+	names := d.torrentsDownloadOrder(urlsByName)
+	if d.torrentsBySize {
+		e.SetLimit(orderedTorrentDownloadWorkers) // without limit all downloads start at once and order means nothing
+	}
+	var fingerprint string
+	var indexed map[string]bool
+	var presentLock sync.Mutex
+	present := map[string]bool{}
+	d.lock.Lock()
+	infoHashes, toBlocks := d.infoHashes, d.toBlocks
+	d.lock.Unlock()
+	if d.torrentsIndex {
+		fingerprint = torrentsFingerprint(urlsByName, infoHashes)
+		indexed = d.loadTorrentsIndex(rootDir, fingerprint)
+	}
+	if d.torrentsETag {
+		d.etags = d.loadTorrentETags(rootDir)
+		defer func() { d.etags = nil }()
+	}
 	//TODO:
 	// - what to do if node already synced?
-	for name, tUrls := range urlsByName {
+	for _, name := range names {
+		tUrls := urlsByName[name]
 		tPath := filepath.Join(rootDir, name)
-		if dir.FileExist(tPath) {
+		expectedHash, hasExpectedHash := infoHashes[strings.TrimSuffix(name, ".torrent")]
+		upToDate := indexed[name] || (dir.FileExist(tPath) && !d.outdatedTorrent(tPath, expectedHash, hasExpectedHash))
+		if upToDate && (d.etags == nil || !d.etags.has(tUrls)) {
+			d.logSkip(name, SkipExists)
+			presentLock.Lock()
+			present[name] = true
+			presentLock.Unlock()
 			continue
 		}
+		if !upToDate && d.etags != nil {
+			d.etags.forget(tUrls)
+		}
 		addedNew++
-		if strings.HasSuffix(name, ".v.torrent") || strings.HasSuffix(name, ".ef.torrent") {
-			_, fName := filepath.Split(name)
-			if strings.HasPrefix(fName, "commitment") {
-				d.logger.Log(d.verbosity, "[snapshots] webseed has .torrent, but we skip it because we don't support it yet", "name", name)
+		if d.skipTorrent(name) {
+			d.logSkip(name, SkipUnsupported)
+			skipped++
+			continue
+		}
+		if d.cutoffBlock > 0 {
+			if toBlock, ok := toBlockOf(name, toBlocks); ok && toBlock <= d.cutoffBlock {
+				d.logSkip(name, SkipBeforeCutoff, "to_block", toBlock, "cutoff", d.cutoffBlock)
 				continue
 			}
 		}
+		pending = append(pending, name)
+	}
+	var stagingDir string
+	if len(pending) > 0 {
+		var err error
+		if stagingDir, err = prepareTorrentsStaging(rootDir); err != nil {
+			d.logger.Error("[snapshots] .torrent files from webseeds not downloaded", "dir", rootDir, "files", len(pending), "err", err)
+			pending = nil
+		} else {
+			defer os.Remove(stagingDir) // empty after all downloads committed or discarded
+		}
+	}
+	if err := d.checkTorrentsDiskCapacity(rootDir, pending); err != nil {
+		d.logger.Error("[snapshots] .torrent files from webseeds not downloaded", "dir", rootDir, "files", len(pending), "err", err)
+		for _, name := range pending {
+			d.logSkip(name, SkipDiskCapacity)
+		}
+		pending = nil
+	}
+	var deadline time.Time
+	if d.torrentsMaxDuration > 0 {
+		deadline = time.Now().Add(d.torrentsMaxDuration)
+	}
+	deadlineExceeded := func() bool { return !deadline.IsZero() && time.Now().After(deadline) }
+	for i, name := range pending {
+		tUrls := urlsByName[name]
+		tPath := filepath.Join(rootDir, name)
+		expectedHash, hasExpectedHash := infoHashes[strings.TrimSuffix(name, ".torrent")]
+		if deadlineExceeded() {
+			d.logger.Warn("[snapshots] webseed .torrent files download took too long, rest of them will be downloaded by next run",
+				"max_duration", d.torrentsMaxDuration, "left", len(pending)-i)
+			for _, name := range pending[i:] {
+				d.logSkip(name, SkipDeadline)
+			}
+			break
+		}
+		if d.byteBudgetExceeded() {
+			d.logger.Warn("[snapshots] webseed discovery byte budget exceeded, rest of .torrent files will be downloaded by next run", "budget", d.byteBudget.HR())
+			for _, name := range pending[i:] {
+				d.logSkip(name, SkipByteBudget)
+			}
+			break
+		}
+		if err := d.waitResumed(ctx); err != nil { // paused: in-flight downloads complete, new ones wait for Resume
+			break
+		}
 		name := name
-		tUrls := tUrls
 		e.Go(func() error {
-			for _, url := range tUrls {
-				res, err := d.callTorrentHttpProvider(ctx, url)
+			if d.byteBudgetExceeded() { // downloads started before budget exceeded
+				d.logSkip(name, SkipByteBudget)
+				return nil
+			}
+			if deadlineExceeded() {
+				d.logSkip(name, SkipDeadline)
+				return nil
+			}
+			if _, err := safeTorrentPath(rootDir, name); err != nil {
+				d.logSkip(name, SkipUnsafePath, "err", err)
+				return nil
+			}
+			saved := false
+			if d.etags != nil {
+				defer func() {
+					if !saved { // ETag is of file we didn't save
+						d.etags.forget(tUrls)
+					}
+				}()
+			}
+			for remaining := tUrls; len(remaining) > 0; {
+				res, served, err := d.fetchTorrent(ctx, name, remaining, filepath.Join(stagingDir, filepath.Base(name)))
+				if errors.Is(err, errNotModified) {
+					saved = true // file on disk is up to date
+					presentLock.Lock()
+					present[name] = true
+					presentLock.Unlock()
+					return nil
+				}
 				if err != nil {
-					d.logger.Debug("[snapshots] callTorrentHttpProvider", "err", err)
-					continue
+					d.logSkip(name, SkipFetchFailed, "err", err)
+					return nil
 				}
 				d.logger.Log(d.verbosity, "[snapshots] downloaded .torrent file from webseed", "name", name)
-				if err := saveTorrent(tPath, res); err != nil {
-					d.logger.Debug("[snapshots] saveTorrent", "err", err)
+				saved, err = d.commitTorrent(ctx, name, tPath, res, expectedHash, hasExpectedHash)
+				res.discard()
+				if err != nil { // not saved locally (disk error, etc.): try copy of next url, as without staging
+					d.logger.Debug("[snapshots] commitTorrent", "err", err)
+					remaining = remaining[served+1:]
 					continue
 				}
+				if saved {
+					d.recordReport(func(r *DiscoveryReport) { r.TorrentsDownloaded++ })
+					presentLock.Lock()
+					present[name] = true
+					presentLock.Unlock()
+				}
 				return nil
 			}
 			return nil
@@ -163,6 +1065,165 @@ func (d *WebSeeds) downloadTorrentFilesFromProviders(ctx context.Context, rootDi
 	if err := e.Wait(); err != nil {
 		d.logger.Debug("[snapshots] webseed discover", "err", err)
 	}
+	if skipped > 0 {
+		d.logger.Info("[snapshots] skipped .torrent files not supported by node", "amount", skipped, "hint", "see --webseed.torrents.commitment")
+	}
+	if d.torrentsIndex {
+		d.saveTorrentsIndex(rootDir, fingerprint, present)
+	}
+	if d.etags != nil {
+		d.saveTorrentETags(rootDir, d.etags)
+	}
+}
+
+// SkipUnsupportedTorrent - default of downloadercfg.Cfg.WebSeedSkipTorrent: commitment .v/.ef files are not supported yet
+func SkipUnsupportedTorrent(name string) bool {
+	return skipUnsupportedTorrent(snaptype.DefaultFileClassifier, name)
+}
+
+func skipUnsupportedTorrent(classifier snaptype.FileClassifier, name string) bool {
+	if !strings.HasSuffix(name, ".torrent") {
+		return false
+	}
+	c := classifier.Classify(name)
+	return c.Category == "commitment" && (c.Ext == ".v" || c.Ext == ".ef")
+}
+
+// toBlockOf - end (exclusive) of block range of .torrent's data file: advertised by manifest or from name of block snapshot
+func toBlockOf(name string, toBlocks map[string]uint64) (uint64, bool) {
+	dataName := strings.TrimSuffix(name, ".torrent")
+	if toBlock, ok := toBlocks[dataName]; ok {
+		return toBlock, true
+	}
+	_, fName := filepath.Split(dataName)
+	if info, ok := snaptype.ParseFileName("", fName); ok {
+		return info.To, true
+	}
+	return 0, false
+}
+
+// matchFilesFilter - name matches if it has one of prefixes, or it's category (see `classifier`) is one of filter items
+func (d *WebSeeds) matchFilesFilter(name string) bool {
+	if len(d.filesFilter) == 0 {
+		return true
+	}
+	_, fName := filepath.Split(strings.TrimSuffix(name, ".torrent"))
+	category := d.classifier.Classify(name).Category
+	for _, f := range d.filesFilter {
+		if strings.HasPrefix(name, f) || strings.HasPrefix(fName, f) || (category != "" && f == category) {
+			return true
+		}
+	}
+	return false
+}
+
+// providerCtx - limits time one provider may consume, so slow mirror can't starve others.
+// `providersLeft` - amount of not-yet-called providers including this one
+func (d *WebSeeds) providerCtx(ctx context.Context, providersLeft int) (context.Context, context.CancelFunc) {
+	timeout := d.providerTimeout
+	if d.providerTimeBudget == downloadercfg.ProviderTimeBudgetEqualSlice && providersLeft > 0 {
+		if deadline, ok := ctx.Deadline(); ok {
+			slice := time.Until(deadline) / time.Duration(providersLeft)
+			if slice < d.providerMinTimeout {
+				slice = d.providerMinTimeout
+			}
+			if timeout == 0 || slice < timeout {
+				timeout = slice
+			}
+		}
+	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// fetchTorrent - from first url which returns valid .torrent file, `served` - index of that url in `tUrls`.
+// If sampled for consistency check - from all urls, and reject file if they have different info-hash.
+func (d *WebSeeds) fetchTorrent(ctx context.Context, name string, tUrls []*url.URL, stagePath string) (res *downloadedTorrent, served int, err error) {
+	if len(tUrls) > 1 && d.torrentConsistencySample > 0 && rand.Float64() < d.torrentConsistencySample {
+		return d.fetchConsistentTorrent(ctx, name, tUrls, stagePath)
+	}
+	for i, url := range tUrls {
+		res, err := d.callTorrentHttpProvider(ctx, url, stagePath)
+		if errors.Is(err, errNotModified) {
+			return nil, i, err
+		}
+		if err != nil {
+			d.logRequest(url, "[snapshots] callTorrentHttpProvider", "err", err)
+			continue
+		}
+		if res == nil {
+			continue
+		}
+		return res, i, nil
+	}
+	return nil, len(tUrls), fmt.Errorf("no valid .torrent file from %d urls", len(tUrls))
+}
+
+// fetchConsistentTorrent - catches providers serving stale or mismatched .torrent for the same name
+func (d *WebSeeds) fetchConsistentTorrent(ctx context.Context, name string, tUrls []*url.URL, stagePath string) (*downloadedTorrent, int, error) {
+	var first *downloadedTorrent
+	var firstUrl *url.URL
+	var served int
+	for i, url := range tUrls {
+		res, err := d.callTorrentHttpProvider(ctx, url, stagePath)
+		if err != nil {
+			d.logRequest(url, "[snapshots] callTorrentHttpProvider", "err", err)
+			continue
+		}
+		if res == nil {
+			continue
+		}
+		if first == nil {
+			first, firstUrl, served = res, url, i
+			continue
+		}
+		res.discard()
+		if res.hash != first.hash {
+			first.discard()
+			d.logger.Warn("[snapshots] webseed providers serve different .torrent for same file", "name", name,
+				"url1", redactUrl(firstUrl), "hash1", first.hash.HexString(), "url2", redactUrl(url), "hash2", res.hash.HexString())
+			return nil, len(tUrls), fmt.Errorf("inconsistent info-hash across providers: %s", name)
+		}
+	}
+	if first == nil {
+		return nil, len(tUrls), fmt.Errorf("no valid .torrent file from %d urls", len(tUrls))
+	}
+	return first, served, nil
+}
+
+// commitTorrent - checks of downloaded .torrent file, then promotes it from staging dir.
+// Not saved and nil error - rejected by checks (skip logged). Error - commit failed
+func (d *WebSeeds) commitTorrent(ctx context.Context, name, tPath string, res *downloadedTorrent, expectedHash metainfo.Hash, hasExpectedHash bool) (bool, error) {
+	if hasExpectedHash && res.hash != expectedHash { // otherwise would re-download it on each run
+		d.logSkip(name, SkipInfoHashMismatch, "expected", expectedHash.HexString(), "got", res.hash.HexString())
+		return false, nil
+	}
+	if badUrl, err := d.notAllowedTorrentUrl(res); err != nil || badUrl != "" {
+		d.logSkip(name, SkipTorrentUrlNotAllowed, "url", badUrl, "err", err)
+		return false, nil
+	}
+	if !d.approveTorrent(name, res) {
+		d.logSkip(name, SkipNotApproved)
+		return false, nil
+	}
+	if ctx.Err() != nil { // shutdown: don't start new saves
+		return false, nil
+	}
+	// saving is not interruptible by ctx: it's fast and atomic, Discover waits for in-flight saves
+	if err := res.commit(tPath); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// approveTorrent - calls user-defined `shouldDownload` hook on already validated .torrent file
+func (d *WebSeeds) approveTorrent(name string, res *downloadedTorrent) bool {
+	if d.shouldDownload == nil {
+		return true
+	}
+	return d.shouldDownload(name, res.mi)
 }
 
 func (d *WebSeeds) TorrentUrls() snaptype.TorrentUrls {
@@ -177,124 +1238,500 @@ func (d *WebSeeds) Len() int {
 	return len(d.byFileName)
 }
 
+// ByFileName - with adaptive weights (see WebSeedWeightDecay) urls of healthier hosts go first
 func (d *WebSeeds) ByFileName(name string) (metainfo.UrlList, bool) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 	v, ok := d.byFileName[name]
-	return v, ok
+	return d.orderByAdaptiveWeightLocked(v), ok
+}
+
+// WebSeedUrl - url of data file and provider which listed it
+type WebSeedUrl struct {
+	Url      string
+	Provider string // redacted url, s3 bucket/key or file path of manifest. Empty for urls added by Merge
+}
+
+// ByFileNameWithSource - as ByFileName (same order), but each url paired with its provider: to attribute downloads to mirrors
+func (d *WebSeeds) ByFileNameWithSource(name string) ([]WebSeedUrl, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	v, ok := d.byFileName[name]
+	if !ok {
+		return nil, false
+	}
+	sources := d.sources[name]
+	providers := make(map[string]string, len(v))
+	for i, u := range v {
+		if i < len(sources) {
+			if _, seen := providers[u]; !seen { // same url listed by several providers: first one
+				providers[u] = sources[i]
+			}
+		}
+	}
+	ordered := d.orderByAdaptiveWeightLocked(v)
+	res := make([]WebSeedUrl, len(ordered))
+	for i, u := range ordered {
+		res[i] = WebSeedUrl{Url: u, Provider: providers[u]}
+	}
+	return res, true
+}
+
+// Merge - folds urls discovered out-of-band (custom transports, tests) into result of last Discover. Urls of same file are
+// appended after already known ones, exact duplicates (by url string) skipped. Not filtered by allowlist, files filter, etc.:
+// caller is responsible for them. Next Discover replaces merged urls with what providers return.
+// Copy-on-write: snapshots taken by ForEachFile/TorrentUrls are not changed
+func (d *WebSeeds) Merge(urls snaptype.WebSeedUrls, torrents snaptype.TorrentUrls) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	byFileName := make(snaptype.WebSeedUrls, len(d.byFileName)+len(urls))
+	for name, l := range d.byFileName {
+		byFileName[name] = l
+	}
+	for name, l := range urls {
+		merged := slices.Clip(byFileName[name]) // append must not write into slice shared with snapshots
+		for _, u := range l {
+			if !slices.Contains(merged, u) {
+				merged = append(merged, u)
+			}
+		}
+		byFileName[name] = merged
+	}
+	torrentUrls := make(snaptype.TorrentUrls, len(d.torrentUrls)+len(torrents))
+	for name, l := range d.torrentUrls {
+		torrentUrls[name] = l
+	}
+	for name, l := range torrents {
+		merged := slices.Clip(torrentUrls[name])
+		for _, u := range l {
+			if !slices.ContainsFunc(merged, func(known *url.URL) bool { return known.String() == u.String() }) {
+				merged = append(merged, u)
+			}
+		}
+		torrentUrls[name] = merged
+	}
+	d.byFileName, d.torrentUrls = byFileName, torrentUrls
+}
+
+// ForEachFile - calls `f` for each discovered data file until it returns false. Order is arbitrary.
+// Walks snapshot of last Discover without copy (maps are replaced, not mutated, by Discover),
+// so `f` may call other methods of WebSeeds. `urls` must not be modified
+func (d *WebSeeds) ForEachFile(f func(name string, urls metainfo.UrlList) bool) {
+	d.lock.Lock()
+	byFileName := d.byFileName
+	d.lock.Unlock()
+	for name, urls := range byFileName {
+		if !f(name, urls) {
+			return
+		}
+	}
+}
+
+// MissingFiles - names from `expected` which no provider listed. Helps find coverage gaps of mirrors
+func (d *WebSeeds) MissingFiles(expected []string) (missing []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, name := range expected {
+		if len(d.byFileName[name]) == 0 {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// ByFileNameBalanced - same as ByFileName, but returns new list in weighted-random order (see `hostWeights` and adaptive weights),
+// so load spreads across mirrors instead of always hammering the first one
+func (d *WebSeeds) ByFileNameBalanced(name string) (metainfo.UrlList, bool) {
+	v, ok := d.ByFileName(name)
+	if !ok {
+		return nil, false
+	}
+	return d.balance(v), true
 }
-func (d *WebSeeds) callHttpProvider(ctx context.Context, webSeedProviderUrl *url.URL) (snaptype.WebSeedsFromProvider, error) {
-	request, err := http.NewRequest(http.MethodGet, webSeedProviderUrl.String(), nil)
+
+// balance - weighted random permutation (Efraimidis-Spirakis): sort by rand^(1/weight) desc
+func (d *WebSeeds) balance(urls metainfo.UrlList) metainfo.UrlList {
+	type weighted struct {
+		url string
+		key float64
+	}
+	l := make([]weighted, len(urls))
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for i, u := range urls {
+		w := 1.0
+		if parsed, err := url.Parse(u); err == nil {
+			if hw, ok := d.hostWeights[parsed.Hostname()]; ok {
+				w = hw
+			}
+			w *= d.adaptiveWeightLocked(parsed)
+		}
+		key := 0.0
+		if w > 0 {
+			key = math.Pow(rand.Float64(), 1/w)
+		}
+		l[i] = weighted{url: u, key: key}
+	}
+	sort.SliceStable(l, func(i, j int) bool { return l[i].key > l[j].key })
+	res := make(metainfo.UrlList, len(l))
+	for i := range l {
+		res[i] = l[i].url
+	}
+	return res
+}
+
+// callUrlProvider - dispatch by scheme of provider url
+func (d *WebSeeds) callUrlProvider(ctx context.Context, u *url.URL) (*webSeedManifest, error) {
+	switch u.Scheme {
+	case "sftp":
+		return d.callSFTPProvider(ctx, u)
+	default:
+		if isGitProvider(u) {
+			return d.callGitProvider(ctx, u)
+		}
+		return d.callHttpProvider(ctx, u)
+	}
+}
+
+func (d *WebSeeds) callHttpProvider(ctx context.Context, webSeedProviderUrl *url.URL) (*webSeedManifest, error) {
+	var latest time.Time
+	if d.freshnessCheck != downloadercfg.FreshnessCheckDisabled {
+		var err error
+		if latest, err = d.fetchLatestMarker(ctx, webSeedProviderUrl); err != nil { // no marker - no check
+			d.logger.Debug("[snapshots] webseed latest marker", "provider", redactUrl(webSeedProviderUrl), "err", err)
+		}
+	}
+	response, err := d.callHttpProviderPage(ctx, webSeedProviderUrl)
 	if err != nil {
 		return nil, err
 	}
-	request = request.WithContext(ctx)
-	resp, err := http.DefaultClient.Do(request)
+	if err := d.checkFreshness(webSeedProviderUrl, latest, response); err != nil {
+		return nil, err
+	}
+	return followManifestPages(response, func(next string) (*webSeedManifest, error) {
+		nextUrl, err := webSeedProviderUrl.Parse(next) // relative to first page
+		if err != nil {
+			return nil, newProviderErr(ProviderErrParse, fmt.Errorf("invalid next page url: %w", err))
+		}
+		if !d.allowedHosts.allowed(nextUrl.Hostname()) {
+			return nil, newProviderErr(ProviderErrParse, fmt.Errorf("host of next page is not allowed: %s", nextUrl.Hostname()))
+		}
+		if d.requireHTTPS && !secureUrl(nextUrl) {
+			return nil, newProviderErr(ProviderErrParse, fmt.Errorf("next page is not https, while https is required: %s", redactUrl(nextUrl)))
+		}
+		return d.callHttpProviderPage(ctx, nextUrl)
+	})
+}
+
+func (d *WebSeeds) callHttpProviderPage(ctx context.Context, webSeedProviderUrl *url.URL) (*webSeedManifest, error) {
+	request, err := d.newRequest(ctx, http.MethodGet, webSeedProviderUrl)
 	if err != nil {
 		return nil, err
 	}
+	resp, err := d.do(request)
+	if err != nil {
+		return nil, classifyNetworkErr(err)
+	}
 	defer resp.Body.Close()
-	response := snaptype.WebSeedsFromProvider{}
-	if err := toml.NewDecoder(resp.Body).Decode(&response); err != nil {
+	if err := checkPartialContent(resp); err != nil {
 		return nil, err
 	}
+	if resp.StatusCode != http.StatusOK {
+		d.checkClockSkewResp(webSeedProviderUrl, resp)
+		return nil, newProviderErr(ProviderErrStatus, fmt.Errorf("unexpected http status: %s", resp.Status))
+	}
+	if d.resumableManifest(resp) {
+		return d.downloadResumableManifest(ctx, webSeedProviderUrl, resp)
+	}
+	response, err := decodeWebSeedsManifest(checkTruncation(resp))
+	if err != nil {
+		if errors.Is(err, ErrTruncatedResponse) {
+			return nil, newProviderErr(ProviderErrOther, err)
+		}
+		return nil, newProviderErr(ProviderErrParse, err)
+	}
 	return response, nil
 }
-func (d *WebSeeds) callS3Provider(ctx context.Context, token string) (snaptype.WebSeedsFromProvider, error) {
-	var bucketName = "erigon-v3-snapshots-" + d.chainName + "-webseed"
-	//v1:base64(accID:accessKeyID:accessKeySecret)
-	l := strings.Split(token, ":")
-	if len(l) != 2 {
-		return nil, fmt.Errorf("token has invalid format, exepcing 'v1:tokenInBase64'")
+func (d *WebSeeds) callS3Provider(ctx context.Context, token string) (*webSeedManifest, error) {
+	t, err := parseS3Token(token)
+	if err != nil {
+		return nil, err
 	}
-	version, tokenInBase64 := strings.TrimSpace(l[0]), strings.TrimSpace(l[1])
-	if version != "v1" {
-		return nil, fmt.Errorf("not supported version: %s", version)
+	var bucketName = d.s3Bucket(t)
+	var fileName = t.objectKey
+	credentialSets := []s3Token{t}
+	if !t.defaultChain && d.s3Credentials == nil {
+		credentialSets = append(credentialSets, t.backups...)
+	}
+	var client *s3.Client
+	getPage := func(key string) (*webSeedManifest, error) {
+		input := &s3.GetObjectInput{Bucket: &bucketName, Key: &key}
+		if d.s3ChecksumValidation == downloadercfg.S3ChecksumValidationWhenSupported {
+			input.ChecksumMode = types.ChecksumModeEnabled
+		}
+		resp, err := client.GetObject(ctx, input)
+		if err != nil {
+			d.checkClockSkewS3(err)
+			return nil, classifyNetworkErr(err)
+		}
+		defer resp.Body.Close()
+		if err := d.checkS3ManifestAge(bucketName, key, resp.LastModified); err != nil {
+			return nil, err
+		}
+		response, err := decodeWebSeedsManifest(resp.Body)
+		if err != nil {
+			return nil, newProviderErr(ProviderErrParse, err)
+		}
+		return response, nil
+	}
+	var response *webSeedManifest
+	for i, creds := range credentialSets {
+		if client, err = d.newS3Client(ctx, t, creds); err != nil {
+			return nil, err
+		}
+		response, err = getPage(fileName)
+		if err == nil {
+			if i > 0 {
+				d.logger.Warn("[snapshots] s3 webseed rejected primary credentials, used backup", "bucket", bucketName, "backup", i)
+			}
+			break
+		}
+		if !isS3AuthErr(err) {
+			return nil, err
+		}
 	}
-	rawDecodedText, err := base64.StdEncoding.DecodeString(tokenInBase64)
 	if err != nil {
 		return nil, err
 	}
-	l = strings.Split(string(rawDecodedText), ":")
-	accountId, accessKeyId, accessKeySecret := strings.TrimSpace(l[0]), strings.TrimSpace(l[1]), strings.TrimSpace(l[2])
-	if len(l) != 3 {
-		return nil, fmt.Errorf("token has invalid format, exepcing 'accountId:accessKeyId:accessKeySecret'")
+	return followManifestPages(response, getPage) // `next` is object key in same bucket
+}
+
+func (d *WebSeeds) s3Bucket(t s3Token) string {
+	if t.defaultChain {
+		return t.bucket
 	}
-	var fileName = "webseeds.toml"
+	return "erigon-v3-snapshots-" + d.chainName + "-webseed"
+}
 
-	r2Resolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
-		return aws.Endpoint{
-			URL: fmt.Sprintf("https://%s.r2.cloudflarestorage.com", accountId),
-		}, nil
-	})
-	cfg, err := config.LoadDefaultConfig(ctx,
-		config.WithEndpointResolverWithOptions(r2Resolver),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKeyId, accessKeySecret, "")),
-	)
+// s3ProviderName - without credentials
+func (d *WebSeeds) s3ProviderName(token string) string {
+	t, err := parseS3Token(token)
 	if err != nil {
-		return nil, err
+		return "s3"
 	}
+	return "s3://" + d.s3Bucket(t) + "/" + t.objectKey
+}
 
-	client := s3.NewFromConfig(cfg)
-	//  {
-	//  	"ChecksumAlgorithm": null,
-	//  	"ETag": "\"eb2b891dc67b81755d2b726d9110af16\"",
-	//  	"Key": "ferriswasm.png",
-	//  	"LastModified": "2022-05-18T17:20:21.67Z",
-	//  	"Owner": null,
-	//  	"Size": 87671,
-	//  	"StorageClass": "STANDARD"
-	//  }
-	resp, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: &bucketName, Key: &fileName})
+// s3TokenEndpoint - empty: aws default endpoint
+func (d *WebSeeds) s3TokenEndpoint(t s3Token) string {
+	if t.defaultChain {
+		return t.endpoint
+	}
+	if d.s3Endpoint != nil {
+		return strings.ReplaceAll(d.s3Endpoint.Endpoint, "{account}", t.accountId)
+	}
+	return fmt.Sprintf("https://%s.r2.cloudflarestorage.com", t.accountId)
+}
+
+// s3ProviderUrl - endpoint of token for logRequest: verbosity override of its host applies. Without host if not known
+func (d *WebSeeds) s3ProviderUrl(token string) *url.URL {
+	if t, err := parseS3Token(token); err == nil {
+		if u, err := url.Parse(d.s3TokenEndpoint(t)); err == nil {
+			return u
+		}
+	}
+	return &url.URL{Scheme: "s3"}
+}
+
+// newS3Client - creds is `t` itself or one of its backups: only credentials fields are taken from it
+func (d *WebSeeds) newS3Client(ctx context.Context, t, creds s3Token) (*s3.Client, error) {
+	opts := []func(*config.LoadOptions) error{
+		config.WithHTTPClient(doerFunc(d.do)),
+	}
+	if t.defaultChain { // credentials and region by aws default chain
+		if t.region != "" {
+			opts = append(opts, config.WithRegion(t.region))
+		}
+		if t.endpoint != "" {
+			opts = append(opts, config.WithEndpointResolverWithOptions(aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+				return aws.Endpoint{URL: t.endpoint, HostnameImmutable: true}, nil
+			})))
+		}
+	} else {
+		var credentialsProvider aws.CredentialsProvider = credentials.NewStaticCredentialsProvider(creds.accessKeyId, creds.accessKeySecret, "")
+		if d.s3Credentials != nil { // rotated outside, token still used for accountId
+			credentialsProvider = d.s3Credentials
+		}
+		endpoint := d.s3TokenEndpoint(creds)
+		if d.s3Endpoint != nil && d.s3Endpoint.Region != "" {
+			opts = append(opts, config.WithRegion(d.s3Endpoint.Region))
+		}
+		r2Resolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+			return aws.Endpoint{
+				URL: endpoint,
+			}, nil
+		})
+		opts = append(opts,
+			config.WithEndpointResolverWithOptions(r2Resolver),
+			config.WithCredentialsProvider(credentialsProvider),
+		)
+	}
+	opts = append(opts, config.WithLogger(logging.LoggerFunc(func(_ logging.Classification, format string, v ...interface{}) {
+		d.logger.Debug("[snapshots] s3 sdk: " + fmt.Sprintf(format, v...)) // for example: response of store without checksum is not validated
+	})))
+	switch d.s3ChecksumValidation {
+	case downloadercfg.S3ChecksumValidationWhenSupported:
+		opts = append(opts, config.WithRequestChecksumCalculation(aws.RequestChecksumCalculationWhenSupported),
+			config.WithResponseChecksumValidation(aws.ResponseChecksumValidationWhenSupported))
+	case downloadercfg.S3ChecksumValidationWhenRequired:
+		opts = append(opts, config.WithRequestChecksumCalculation(aws.RequestChecksumCalculationWhenRequired),
+			config.WithResponseChecksumValidation(aws.ResponseChecksumValidationWhenRequired))
+	}
+	if d.userAgent != "" {
+		opts = append(opts, config.WithAPIOptions([]func(*middleware.Stack) error{awsmiddleware.AddUserAgentKey(d.userAgent)}))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	response := snaptype.WebSeedsFromProvider{}
-	if err := toml.NewDecoder(resp.Body).Decode(&response); err != nil {
+	return s3.NewFromConfig(cfg), nil
+}
+
+// newRequest - all requests to providers must go through it: it sets identification headers
+func (d *WebSeeds) newRequest(ctx context.Context, method string, u *url.URL) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
 		return nil, err
 	}
-	return response, nil
+	if d.userAgent != "" {
+		request.Header.Set("User-Agent", d.userAgent)
+	}
+	if host, ok := d.hostOverrides[u.Hostname()]; ok {
+		request.Host = host
+	}
+	return request, nil
 }
-func (d *WebSeeds) callTorrentHttpProvider(ctx context.Context, url *url.URL) ([]byte, error) {
-	request, err := http.NewRequest(http.MethodGet, url.String(), nil)
+
+// maxTorrentFileSize - protect against too big data
+const maxTorrentFileSize = 128 * datasize.MB
+
+// headTorrent - cheap preflight: skip GET of urls which don't exist on mirror.
+// Servers which don't support HEAD (405/501) remembered and next time preflight skipped for them.
+func (d *WebSeeds) headTorrent(ctx context.Context, url *url.URL) error {
+	d.lock.Lock()
+	_, noHead := d.noHeadHosts[url.Host]
+	d.lock.Unlock()
+	if noHead {
+		return nil
+	}
+	request, err := d.newRequest(ctx, http.MethodHead, url)
+	if err != nil {
+		return err
+	}
+	resp, err := d.do(request)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented:
+		d.lock.Lock()
+		if d.noHeadHosts == nil {
+			d.noHeadHosts = map[string]struct{}{}
+		}
+		d.noHeadHosts[url.Host] = struct{}{}
+		d.lock.Unlock()
+		return nil
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("HEAD %s: %s", url.Path, resp.Status)
+	case resp.ContentLength == 0 || resp.ContentLength > int64(maxTorrentFileSize):
+		return fmt.Errorf("HEAD %s: unexpected Content-Length %d", url.Path, resp.ContentLength)
+	}
+	return nil
+}
+
+// callTorrentHttpProvider - downloads .torrent file to temp file next to `stagePath` (in staging dir), nil if mirror has no valid file
+func (d *WebSeeds) callTorrentHttpProvider(ctx context.Context, url *url.URL, stagePath string) (*downloadedTorrent, error) {
+	if d.torrentHeadPreflight {
+		if err := d.headTorrent(ctx, url); err != nil {
+			return nil, err
+		}
+	}
+	request, err := d.newRequest(ctx, http.MethodGet, url)
 	if err != nil {
 		return nil, err
 	}
-	request = request.WithContext(ctx)
-	resp, err := http.DefaultClient.Do(request)
+	if d.etags != nil {
+		if etag := d.etags.get(url); etag != "" && d.supportsETag(url.Host) {
+			request.Header.Set("If-None-Match", etag)
+		}
+	}
+	resp, err := d.do(request)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, errNotModified
+	}
+	if err := checkPartialContent(resp); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusBadRequest { // signed url rejected
+		d.checkClockSkewResp(url, resp)
+		return nil, newProviderErr(ProviderErrStatus, fmt.Errorf("unexpected http status: %s", resp.Status))
+	}
 	//protect against too small and too big data
-	if resp.ContentLength == 0 || resp.ContentLength > int64(128*datasize.MB) {
+	if resp.ContentLength == 0 || resp.ContentLength > int64(maxTorrentFileSize) {
 		return nil, nil
 	}
-	res, err := io.ReadAll(resp.Body)
+	dir, fName := filepath.Split(stagePath)
+	res, err := streamTorrent(d.torrentFS, dir, fName, d.rateLimitedReader(ctx, url.Host, checkTruncation(resp)))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid bytes received from url %s, err=%w", url.Path, err)
 	}
-	if err = validateTorrentBytes(res, url.Path); err != nil {
-		return nil, err
+	if d.etags != nil {
+		d.etags.set(url, resp.Header.Get("ETag"))
 	}
 	return res, nil
 }
-func validateTorrentBytes(b []byte, url string) error {
+
+func torrentInfoHash(b []byte) (metainfo.Hash, error) {
 	var mi metainfo.MetaInfo
 	if err := bencode.NewDecoder(bytes.NewBuffer(b)).Decode(&mi); err != nil {
-		return fmt.Errorf("invalid bytes received from url %s, err=%w", url, err)
+		return metainfo.Hash{}, err
 	}
-	return nil
+	return mi.HashInfoBytes(), nil
+}
+
+// diskProvidersReadWorkers - disk providers may be on network filesystem (NFS), where each read is slow
+const diskProvidersReadWorkers = 8
+
+// readWebSeedsFiles - reads files in parallel, results are in order of `paths` (so merge is deterministic)
+func (d *WebSeeds) readWebSeedsFiles(paths []string) ([]*webSeedManifest, []error) {
+	responses, errs := make([]*webSeedManifest, len(paths)), make([]error, len(paths))
+	var g errgroup.Group
+	g.SetLimit(diskProvidersReadWorkers)
+	for i, path := range paths {
+		i, path := i, path
+		g.Go(func() error {
+			responses[i], errs[i] = d.readWebSeedsFile(path)
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return responses, errs
 }
-func (d *WebSeeds) readWebSeedsFile(webSeedProviderPath string) (snaptype.WebSeedsFromProvider, error) {
-	data, err := os.ReadFile(webSeedProviderPath)
+
+func (d *WebSeeds) readWebSeedsFile(webSeedProviderPath string) (*webSeedManifest, error) {
+	f, err := os.Open(webSeedProviderPath)
 	if err != nil {
 		return nil, err
 	}
-	response := snaptype.WebSeedsFromProvider{}
-	if err := toml.Unmarshal(data, &response); err != nil {
-		return nil, err
+	defer f.Close()
+	response, err := decodeWebSeedsManifest(f)
+	if err != nil {
+		return nil, newProviderErr(ProviderErrParse, err)
 	}
 	return response, nil
 }
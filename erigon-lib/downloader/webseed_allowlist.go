@@ -0,0 +1,107 @@
+package downloader
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// hostAllowlist - protects against SSRF: manifests from semi-trusted sources may point urls to internal services.
+// Only literal hosts of urls are checked, names are not resolved.
+type hostAllowlist struct {
+	hosts    map[string]struct{}
+	suffixes []string // from `*.example.com` entries, with leading "."
+	prefixes []netip.Prefix
+}
+
+// parseHostAllowlist - entries: `example.com`, `*.example.com` (any subdomain) or CIDR `10.0.0.0/8`. Empty list - nil (allow all)
+func parseHostAllowlist(entries []string) (*hostAllowlist, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	res := &hostAllowlist{hosts: map[string]struct{}{}}
+	for _, e := range entries {
+		e = strings.ToLower(strings.TrimSpace(e))
+		switch {
+		case e == "":
+			continue
+		case strings.Contains(e, "/"):
+			prefix, err := netip.ParsePrefix(e)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowed host %q: %w", e, err)
+			}
+			res.prefixes = append(res.prefixes, prefix.Masked())
+		case strings.HasPrefix(e, "*."):
+			res.suffixes = append(res.suffixes, e[1:])
+		default:
+			res.hosts[e] = struct{}{}
+		}
+	}
+	return res, nil
+}
+
+// allowed - host without port. nil allowlist allows all
+func (l *hostAllowlist) allowed(host string) bool {
+	if l == nil {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if _, ok := l.hosts[host]; ok {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		addr, ok := netip.AddrFromSlice(ip)
+		if !ok {
+			return false
+		}
+		addr = addr.Unmap()
+		for _, prefix := range l.prefixes {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, suffix := range l.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *hostAllowlist) allowedUrl(rawUrl string) bool {
+	if l == nil {
+		return true
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return false
+	}
+	return l.allowed(u.Hostname())
+}
+
+// notAllowedTorrentUrl - first tracker or webseed url (redacted) of .torrent file which host is not allowed, empty if all allowed.
+// Only with `checkTorrentUrls`
+func (d *WebSeeds) notAllowedTorrentUrl(res *downloadedTorrent) (string, error) {
+	if !d.checkTorrentUrls || d.allowedHosts == nil {
+		return "", nil
+	}
+	mi := res.mi
+	urls := append([]string{mi.Announce}, mi.UrlList...)
+	for _, tier := range mi.AnnounceList {
+		urls = append(urls, tier...)
+	}
+	for _, u := range urls {
+		if u == "" || d.allowedHosts.allowedUrl(u) {
+			continue
+		}
+		if parsed, err := url.Parse(u); err == nil {
+			return redactUrl(parsed), nil
+		}
+		return "<invalid url>", nil
+	}
+	return "", nil
+}
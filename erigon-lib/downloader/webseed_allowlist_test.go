@@ -0,0 +1,130 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsAllowedHosts(t *testing.T) {
+	require := require.New(t)
+	_, err := parseHostAllowlist([]string{"10.0.0.0/33"})
+	require.Error(err)
+
+	l, err := parseHostAllowlist([]string{"a.com", "*.cdn.com", "10.0.0.0/8", "fd00::/8"})
+	require.NoError(err)
+	require.True(l.allowed("a.com"))
+	require.False(l.allowed("b.a.com"))
+	require.True(l.allowed("eu.cdn.com"))
+	require.False(l.allowed("cdn.com"))
+	require.True(l.allowed("10.1.2.3"))
+	require.False(l.allowed("169.254.169.254"))
+	require.True(l.allowed("fd00::1"))
+	require.False(l.allowed("::1"))
+
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`
+"a.seg" = "https://a.com/a.seg"
+"b.seg" = "http://169.254.169.254/latest/meta-data"
+"b.seg.torrent" = "http://localhost:8080/admin"
+`), 0644))
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedAllowedHosts: []string{"a.com"}})
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+	require.Equal(1, ws.Len())
+	require.Equal(0, len(ws.TorrentUrls()))
+}
+
+func TestWebSeedsCheckTorrentUrls(t *testing.T) {
+	require := require.New(t)
+	torrentBytes := func(name string, mi metainfo.MetaInfo) []byte {
+		info := metainfo.Info{Name: name, Length: 1, PieceLength: 256 * 1024, Pieces: make([]byte, 20)}
+		infoBytes, err := bencode.Marshal(info)
+		require.NoError(err)
+		mi.InfoBytes = infoBytes
+		var buf bytes.Buffer
+		require.NoError(mi.Write(&buf))
+		return buf.Bytes()
+	}
+	torrents := map[string][]byte{
+		"good.seg.torrent": torrentBytes("good.seg", metainfo.MetaInfo{Announce: "udp://tracker.example.com:80/announce",
+			UrlList: metainfo.UrlList{"https://mirror.example.com/good.seg"}}),
+		"tracker.seg.torrent":      torrentBytes("tracker.seg", metainfo.MetaInfo{Announce: "http://169.254.169.254/latest/meta-data"}),
+		"announcelist.seg.torrent": torrentBytes("announcelist.seg", metainfo.MetaInfo{AnnounceList: [][]string{{"udp://tracker.example.com:80"}, {"http://localhost:6379/"}}}),
+		"webseed.seg.torrent":      torrentBytes("webseed.seg", metainfo.MetaInfo{UrlList: metainfo.UrlList{"http://10.0.0.1/webseed.seg?token=secret"}}),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(torrents[strings.TrimPrefix(r.URL.Path, "/")])
+	}))
+	defer srv.Close()
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	var lines []string
+	for name := range torrents {
+		lines = append(lines, fmt.Sprintf("%q = \"%s/%s\"", name, srv.URL, name))
+	}
+	require.NoError(os.WriteFile(manifest, []byte(strings.Join(lines, "\n")), 0644))
+
+	for _, c := range []struct {
+		check    bool
+		expected []string
+	}{
+		{false, []string{"announcelist.seg.torrent", "good.seg.torrent", "tracker.seg.torrent", "webseed.seg.torrent"}},
+		{true, []string{"good.seg.torrent"}},
+	} {
+		dir := t.TempDir()
+		ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedAllowedHosts: []string{"127.0.0.1", "*.example.com"}, WebSeedCheckTorrentUrls: c.check})
+		ws.downloadTorrentFile = true
+		ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+		ws.downloadTorrentFilesFromProviders(context.Background(), dir)
+		entries, err := os.ReadDir(dir)
+		require.NoError(err)
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		require.Equal(c.expected, names, c.check)
+	}
+}
+
+func TestWebSeedsRedirectAllowedHosts(t *testing.T) {
+	require := require.New(t)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `"a.seg" = "https://a.com/a.seg"`)
+	}))
+	defer target.Close()
+	_, targetPort, err := net.SplitHostPort(target.Listener.Addr().String())
+	require.NoError(err)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://"+net.JoinHostPort(r.URL.Query().Get("to"), targetPort)+"/webseeds.toml", http.StatusFound)
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedAllowedHosts: []string{"127.0.0.1"}})
+	u, err := url.Parse(srv.URL + "/webseeds.toml?to=127.0.0.1")
+	require.NoError(err)
+	res, err := ws.callHttpProvider(ctx, u)
+	require.NoError(err)
+	require.Len(res.files, 1)
+
+	u, err = url.Parse(srv.URL + "/webseeds.toml?to=localhost")
+	require.NoError(err)
+	_, err = ws.callHttpProvider(ctx, u)
+	require.ErrorContains(err, "redirect to not allowed host: localhost")
+
+	ws = newTestWebSeeds(t, nil) // no allowlist: any host
+	_, err = ws.callHttpProvider(ctx, u)
+	require.NoError(err)
+}
@@ -0,0 +1,102 @@
+package downloader
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// TorrentHashMismatch - .torrent file on disk which doesn't match info-hash advertised by manifest
+type TorrentHashMismatch struct {
+	Name     string // data file name, relative to rootDir
+	Expected metainfo.Hash
+	Actual   metainfo.Hash // zero if .torrent file is unreadable, see Err
+	Err      error
+}
+
+// AuditTorrentFiles - read-only check of existing .torrent files in rootDir against info-hashes of last Discover.
+// Files without advertised info-hash are skipped. Allows detect drift/corruption of populated dir.
+func (d *WebSeeds) AuditTorrentFiles(rootDir string) ([]TorrentHashMismatch, error) {
+	d.lock.Lock()
+	expected := d.infoHashes
+	d.lock.Unlock()
+	if len(expected) == 0 {
+		return nil, nil
+	}
+
+	var res []TorrentHashMismatch
+	err := filepath.WalkDir(rootDir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".torrent") {
+			return nil
+		}
+		rel, err := filepath.Rel(rootDir, path)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.ToSlash(rel), ".torrent")
+		want, ok := expected[name]
+		if !ok {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			res = append(res, TorrentHashMismatch{Name: name, Expected: want, Err: err})
+			return nil
+		}
+		got, err := torrentInfoHash(data)
+		if err != nil {
+			res = append(res, TorrentHashMismatch{Name: name, Expected: want, Err: err})
+			return nil
+		}
+		if got != want {
+			res = append(res, TorrentHashMismatch{Name: name, Expected: want, Actual: got})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// PruneStaleTorrents - .torrent files in rootDir which are not advertised by providers anymore (by last Discover).
+// Report-only unless `remove` is set: .torrent files of locally created snapshots also are not in manifest.
+// If nothing discovered (for example, all providers are down) - nothing is stale.
+func (d *WebSeeds) PruneStaleTorrents(rootDir string, remove bool) (stale []string, err error) {
+	advertised := d.TorrentUrls()
+	if len(advertised) == 0 {
+		return nil, nil
+	}
+	err = filepath.WalkDir(rootDir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".torrent") {
+			return nil
+		}
+		rel, err := filepath.Rel(rootDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if _, ok := advertised[name]; ok {
+			return nil
+		}
+		stale = append(stale, name)
+		if !remove {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		d.logger.Log(d.verbosity, "[snapshots] removed .torrent file not advertised by webseed providers", "name", name)
+		return nil
+	})
+	return stale, err
+}
@@ -0,0 +1,70 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsAuditTorrentFiles(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	good, bad := testTorrentBytes(t, "a.seg"), testTorrentBytes(t, "b.seg")
+	goodHash, err := torrentInfoHash(good)
+	require.NoError(err)
+	require.NoError(os.WriteFile(filepath.Join(dir, "a.seg.torrent"), good, 0644))
+	require.NoError(os.WriteFile(filepath.Join(dir, "b.seg.torrent"), bad, 0644))
+	require.NoError(os.WriteFile(filepath.Join(dir, "c.seg.torrent"), []byte("garbage"), 0644))
+	require.NoError(os.WriteFile(filepath.Join(dir, "d.seg.torrent"), []byte("not in manifest"), 0644))
+
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(fmt.Sprintf(`
+"a.seg" = { url = "https://a.com/a.seg", info_hash = "%[1]s" }
+"b.seg" = { url = "https://a.com/b.seg", info_hash = "%[1]s" }
+"c.seg" = { url = "https://a.com/c.seg", info_hash = "%[1]s" }
+"d.seg" = "https://a.com/d.seg"
+`, goodHash.HexString())), 0644))
+	ws := newTestWebSeeds(t, nil)
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+
+	mismatches, err := ws.AuditTorrentFiles(dir)
+	require.NoError(err)
+	require.Equal(2, len(mismatches))
+	require.Equal("b.seg", mismatches[0].Name)
+	require.NoError(mismatches[0].Err)
+	require.NotEqual(goodHash, mismatches[0].Actual)
+	require.Equal("c.seg", mismatches[1].Name)
+	require.Error(mismatches[1].Err)
+}
+
+func TestWebSeedsPruneStaleTorrents(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	for _, name := range []string{"a.seg.torrent", "b.seg.torrent", "b.seg"} {
+		require.NoError(os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644))
+	}
+	ws := newTestWebSeeds(t, nil)
+	stale, err := ws.PruneStaleTorrents(dir, true)
+	require.NoError(err)
+	require.Nil(stale) // nothing discovered yet
+
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`"a.seg.torrent" = "https://a.com/a.seg.torrent"`), 0644))
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+
+	stale, err = ws.PruneStaleTorrents(dir, false)
+	require.NoError(err)
+	require.Equal([]string{"b.seg.torrent"}, stale)
+	require.FileExists(filepath.Join(dir, "b.seg.torrent"))
+
+	stale, err = ws.PruneStaleTorrents(dir, true)
+	require.NoError(err)
+	require.Equal([]string{"b.seg.torrent"}, stale)
+	require.NoFileExists(filepath.Join(dir, "b.seg.torrent"))
+	require.FileExists(filepath.Join(dir, "a.seg.torrent"))
+	require.FileExists(filepath.Join(dir, "b.seg"))
+}
@@ -0,0 +1,123 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ProviderCapabilities - features of provider's http server, detected by WebSeeds.CapabilityProbe
+type ProviderCapabilities struct {
+	Head          bool   // answers HEAD. If not: HEAD preflights are skipped for host
+	RangeRequests bool   // `Accept-Ranges: bytes` or 206 for range request: downloads may be split or resumed
+	ETag          bool   // has ETag: conditional requests possible. If not: If-None-Match not sent to host
+	Compression   string // Content-Encoding of response to `Accept-Encoding: gzip`, empty - not compressed
+	Proto         string // for example "HTTP/2.0"
+}
+
+// CapabilityProbe - detects features of server of `provider` (http url), 1-2 requests. Result is cached by host:
+// next calls for urls of same host return it without requests
+func (d *WebSeeds) CapabilityProbe(ctx context.Context, provider string) (ProviderCapabilities, error) {
+	u, err := url.Parse(provider)
+	if err != nil {
+		return ProviderCapabilities{}, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ProviderCapabilities{}, fmt.Errorf("capability probe: not http provider: %s", redactUrl(u))
+	}
+	d.lock.Lock()
+	c, ok := d.capabilities[u.Host]
+	d.lock.Unlock()
+	if ok {
+		return c, nil
+	}
+
+	resp, err := d.probeRequest(ctx, http.MethodHead, u)
+	if err != nil {
+		return ProviderCapabilities{}, err
+	}
+	c.Head = resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented
+	if !c.Head {
+		if resp, err = d.probeRequest(ctx, http.MethodGet, u); err != nil {
+			return ProviderCapabilities{}, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return ProviderCapabilities{}, newProviderErr(ProviderErrStatus, fmt.Errorf("capability probe: unexpected http status: %s", resp.Status))
+	}
+	c.RangeRequests = resp.StatusCode == http.StatusPartialContent || strings.Contains(resp.Header.Get("Accept-Ranges"), "bytes")
+	c.ETag = resp.Header.Get("ETag") != ""
+	c.Compression = resp.Header.Get("Content-Encoding")
+	c.Proto = resp.Proto
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.capabilities == nil {
+		d.capabilities = map[string]ProviderCapabilities{}
+	}
+	d.capabilities[u.Host] = c
+	if !c.Head {
+		if d.noHeadHosts == nil {
+			d.noHeadHosts = map[string]struct{}{}
+		}
+		d.noHeadHosts[u.Host] = struct{}{}
+	}
+	return c, nil
+}
+
+// probeRequest - GET asks for 1 byte: 206 means range requests supported. Body is not read
+func (d *WebSeeds) probeRequest(ctx context.Context, method string, u *url.URL) (*http.Response, error) {
+	request, err := d.newRequest(ctx, method, u)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept-Encoding", "gzip") // explicit: transport doesn't hide Content-Encoding of response
+	if method == http.MethodGet {
+		request.Header.Set("Range", "bytes=0-0")
+	}
+	resp, err := d.do(request)
+	if err != nil {
+		return nil, classifyNetworkErr(err)
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1))
+	resp.Body.Close()
+	return resp, nil
+}
+
+// probeProviders - with `capabilityProbe`, failed probe is not fatal: provider is called anyway
+func (d *WebSeeds) probeProviders(ctx context.Context, httpProviders []*url.URL) {
+	if !d.capabilityProbe {
+		return
+	}
+	for _, u := range httpProviders {
+		if u.Scheme != "http" && u.Scheme != "https" {
+			continue
+		}
+		c, err := d.CapabilityProbe(ctx, u.String())
+		if err != nil {
+			d.logger.Debug("[snapshots] webseed capability probe", "url", redactUrl(u), "err", err)
+			continue
+		}
+		d.logger.Debug("[snapshots] webseed capability probe", "url", redactUrl(u), "head", c.Head, "range", c.RangeRequests,
+			"etag", c.ETag, "compression", c.Compression, "proto", c.Proto)
+	}
+}
+
+// supportsETag - true unless probe found that host doesn't send ETag
+func (d *WebSeeds) supportsETag(host string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	c, ok := d.capabilities[host]
+	return !ok || c.ETag
+}
+
+// supportsRange - true unless probe found that host doesn't support range requests
+func (d *WebSeeds) supportsRange(host string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	c, ok := d.capabilities[host]
+	return !ok || c.RangeRequests
+}
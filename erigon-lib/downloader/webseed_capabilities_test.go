@@ -0,0 +1,66 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsCapabilityProbe(t *testing.T) {
+	require := require.New(t)
+	var requests atomic.Int32
+	noHead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		http.ServeContent(w, r, "webseeds.toml", time.Time{}, strings.NewReader(`"a.seg" = "https://a.com/a.seg"`))
+	}))
+	defer noHead.Close()
+	full := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		require.Equal("gzip", r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Encoding", "gzip")
+	}))
+	defer full.Close()
+
+	ws := newTestWebSeeds(t, nil)
+	c, err := ws.CapabilityProbe(context.Background(), noHead.URL+"/webseeds.toml")
+	require.NoError(err)
+	require.Equal(ProviderCapabilities{RangeRequests: true, Proto: "HTTP/1.1"}, c)
+	require.Equal(int32(2), requests.Load())
+	_, err = ws.CapabilityProbe(context.Background(), noHead.URL+"/other.toml") // cached by host
+	require.NoError(err)
+	require.Equal(int32(2), requests.Load())
+	u, err := url.Parse(noHead.URL + "/a.seg.torrent")
+	require.NoError(err)
+	require.NoError(ws.headTorrent(context.Background(), u)) // HEAD skipped
+	require.Equal(int32(2), requests.Load())
+
+	c, err = ws.CapabilityProbe(context.Background(), full.URL+"/webseeds.toml")
+	require.NoError(err)
+	require.Equal(ProviderCapabilities{Head: true, RangeRequests: true, ETag: true, Compression: "gzip", Proto: "HTTP/1.1"}, c)
+	require.True(ws.supportsETag(strings.TrimPrefix(full.URL, "http://")))
+	require.False(ws.supportsETag(strings.TrimPrefix(noHead.URL, "http://")))
+
+	_, err = ws.CapabilityProbe(context.Background(), "s3://bucket")
+	require.Error(err)
+
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedCapabilityProbe: true})
+	u, err = url.Parse(noHead.URL + "/webseeds.toml")
+	require.NoError(err)
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, []*url.URL{u}, nil)
+	require.Equal(1, ws.Len())
+	require.Equal(1, len(ws.capabilities))
+}
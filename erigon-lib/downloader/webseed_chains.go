@@ -0,0 +1,109 @@
+package downloader
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// chainsIndexName - http provider serving manifests of many chains lists them (1 chain name per line) in this file next to manifest
+const chainsIndexName = "chains.txt"
+
+const maxChainsIndexSize = 64 * 1024
+
+// DiscoverChains - chains which manifests are served by provider, sorted. Provider is http url of manifest or s3 token.
+// In s3 bucket manifest of chain is `<chain>/webseeds.toml` (or .json), see objectKey of parseS3Token
+func (d *WebSeeds) DiscoverChains(ctx context.Context, provider string) ([]string, error) {
+	if strings.HasPrefix(provider, "http://") || strings.HasPrefix(provider, "https://") {
+		u, err := url.Parse(provider)
+		if err != nil {
+			return nil, err
+		}
+		return d.discoverHttpChains(ctx, u)
+	}
+	if d.disableS3 {
+		return nil, fmt.Errorf("s3 webseed providers are disabled by config")
+	}
+	return d.discoverS3Chains(ctx, provider)
+}
+
+func (d *WebSeeds) discoverHttpChains(ctx context.Context, providerUrl *url.URL) ([]string, error) {
+	u, err := providerUrl.Parse(chainsIndexName)
+	if err != nil {
+		return nil, err
+	}
+	request, err := d.newRequest(ctx, http.MethodGet, u)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.do(request)
+	if err != nil {
+		return nil, classifyNetworkErr(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newProviderErr(ProviderErrStatus, fmt.Errorf("unexpected http status: %s", resp.Status))
+	}
+	chains := map[string]struct{}{}
+	scanner := bufio.NewScanner(io.LimitReader(checkTruncation(resp), maxChainsIndexSize))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		chains[line] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sortedKeys(chains), nil
+}
+
+func (d *WebSeeds) discoverS3Chains(ctx context.Context, token string) ([]string, error) {
+	t, err := parseS3Token(token)
+	if err != nil {
+		return nil, err
+	}
+	client, err := d.newS3Client(ctx, t, t)
+	if err != nil {
+		return nil, err
+	}
+	bucketName := d.s3Bucket(t)
+	chains := map[string]struct{}{}
+	pages := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{Bucket: &bucketName})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			d.checkClockSkewS3(err)
+			return nil, classifyNetworkErr(err)
+		}
+		for _, obj := range page.Contents {
+			if obj.Key == nil {
+				continue
+			}
+			dir, name := path.Split(*obj.Key)
+			if dir == "" || (name != "webseeds.toml" && name != "webseeds.json") {
+				continue
+			}
+			chains[path.Base(dir)] = struct{}{}
+		}
+	}
+	return sortedKeys(chains), nil
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,41 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsDiscoverChains(t *testing.T) {
+	require := require.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("list-type") == "2" { // s3 ListObjectsV2 through proxy
+			_, _ = fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Name>bucket</Name><IsTruncated>false</IsTruncated>
+<Contents><Key>mainnet/webseeds.toml</Key></Contents><Contents><Key>gnosis/webseeds.json</Key></Contents>
+<Contents><Key>mainnet/other.toml</Key></Contents><Contents><Key>webseeds.toml</Key></Contents></ListBucketResult>`)
+			return
+		}
+		require.Equal("/mirror/chains.txt", r.URL.Path)
+		_, _ = fmt.Fprint(w, "# chains\nmainnet\n\ngnosis\nmainnet\n")
+	}))
+	defer srv.Close()
+	ws := newTestWebSeeds(t, nil)
+	chains, err := ws.DiscoverChains(context.Background(), srv.URL+"/mirror/webseeds.toml")
+	require.NoError(err)
+	require.Equal([]string{"gnosis", "mainnet"}, chains)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_CA_BUNDLE", "")
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedProxy: srv.URL})
+	chains, err = ws.DiscoverChains(context.Background(), "s3://bucket?region=us-east-1&endpoint=http://s3.invalid")
+	require.NoError(err)
+	require.Equal([]string{"gnosis", "mainnet"}, chains)
+}
@@ -0,0 +1,219 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+// ErrChecksumMismatch - downloaded data doesn't match checksum published by mirror
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// maxChecksumFileSize - sidecar has 1 line
+const maxChecksumFileSize = 4096
+
+// ChecksumUrl - by convention mirrors publish checksum of `file` as `file.checksum` next to it. Query (auth token) is kept
+func ChecksumUrl(dataUrl string) (string, error) {
+	u, err := url.Parse(dataUrl)
+	if err != nil {
+		return "", err
+	}
+	u.Path += ".checksum"
+	if u.RawPath != "" {
+		u.RawPath += ".checksum"
+	}
+	return u.String(), nil
+}
+
+// checksumHashers - algorithms which producers of files may declare in sidecar
+var checksumHashers = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"blake3": func() hash.Hash { return blake3.New(32, nil) },
+	"crc32c": func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) },
+}
+
+// defaultChecksumAlgo - of sidecar without algorithm
+const defaultChecksumAlgo = "sha256"
+
+type checksum struct {
+	algo string
+	sum  []byte
+}
+
+func (c checksum) String() string { return fmt.Sprintf("%s:%x", c.algo, c.sum) }
+
+// newHasher - unknown algorithm is error: file must not be accepted without verification
+func (c checksum) newHasher() (hash.Hash, error) {
+	newHash, ok := checksumHashers[c.algo]
+	if !ok {
+		return nil, fmt.Errorf("not supported checksum algorithm: %s", c.algo)
+	}
+	return newHash(), nil
+}
+
+// parseChecksum - formats: `<hex>`, `<algo>:<hex>` (for example `blake3:<hex>`), output of sha256sum/b3sum: `<hex>  <file name>`.
+// Without algorithm - sha256
+func parseChecksum(b []byte) (*checksum, error) {
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty checksum file")
+	}
+	c := &checksum{algo: defaultChecksumAlgo}
+	s := fields[0]
+	if algo, sum, ok := strings.Cut(s, ":"); ok {
+		c.algo, s = strings.ToLower(algo), sum
+	}
+	h, err := c.newHasher()
+	if err != nil {
+		return nil, err
+	}
+	if c.sum, err = hex.DecodeString(s); err != nil {
+		return nil, fmt.Errorf("invalid checksum: %w", err)
+	}
+	if len(c.sum) != h.Size() {
+		return nil, fmt.Errorf("invalid %s checksum length: %d", c.algo, len(c.sum))
+	}
+	return c, nil
+}
+
+// fetchChecksum - nil if mirror doesn't publish sidecar
+func (d *WebSeeds) fetchChecksum(ctx context.Context, dataUrl string) (*checksum, error) {
+	checksumUrl, err := ChecksumUrl(dataUrl)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(checksumUrl)
+	if err != nil {
+		return nil, err
+	}
+	request, err := d.newRequest(ctx, http.MethodGet, u)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.do(request)
+	if err != nil {
+		return nil, classifyNetworkErr(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newProviderErr(ProviderErrStatus, fmt.Errorf("checksum: unexpected http status: %s", resp.Status))
+	}
+	b, err := io.ReadAll(io.LimitReader(checkTruncation(resp), maxChecksumFileSize))
+	if err != nil {
+		return nil, err
+	}
+	return parseChecksum(b)
+}
+
+// DownloadFile - downloads data file `name` from first of its webseed urls which succeeds, to `dst` (atomically).
+// With `WebSeedVerifyChecksum` verifies data against checksum of manifest entry, or if entry has none - against
+// sidecar `.checksum` of same url (see ChecksumUrl), mirror without sidecar is trusted.
+// On mismatch tries next url, if all failed - error wraps ErrChecksumMismatch
+func (d *WebSeeds) DownloadFile(ctx context.Context, name, dst string) error {
+	urls, ok := d.ByFileName(name)
+	if !ok {
+		return fmt.Errorf("no webseed urls for file: %s", name)
+	}
+	d.lock.Lock()
+	declared := d.checksums[name]
+	d.lock.Unlock()
+	var errs []error
+	for _, dataUrl := range urls {
+		err := d.downloadFile(ctx, dataUrl, dst, declared)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		u, _ := url.Parse(dataUrl)
+		d.logger.Debug("[snapshots] webseed download file", "name", name, "url", redactUrl(u), "err", err)
+		errs = append(errs, err)
+	}
+	return fmt.Errorf("download %s from %d urls: %w", name, len(urls), errors.Join(errs...))
+}
+
+// downloadFile - `declared` is checksum of manifest entry: if set, sidecar is not fetched
+func (d *WebSeeds) downloadFile(ctx context.Context, dataUrl, dst string, declared *checksum) (err error) {
+	var expected *checksum
+	var h hash.Hash
+	if d.verifyChecksum {
+		expected = declared
+		if expected == nil {
+			if expected, err = d.fetchChecksum(ctx, dataUrl); err != nil {
+				return err
+			}
+		}
+		if expected != nil {
+			if h, err = expected.newHasher(); err != nil {
+				return err
+			}
+		}
+	}
+	u, err := url.Parse(dataUrl)
+	if err != nil {
+		return err
+	}
+	request, err := d.newRequest(ctx, http.MethodGet, u)
+	if err != nil {
+		return err
+	}
+	resp, err := d.do(request)
+	if err != nil {
+		return classifyNetworkErr(err)
+	}
+	defer resp.Body.Close()
+	if err := checkPartialContent(resp); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return newProviderErr(ProviderErrStatus, fmt.Errorf("unexpected http status: %s", resp.Status))
+	}
+
+	dir, fName := filepath.Split(dst)
+	f, err := os.CreateTemp(dir, fName+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+	var w io.Writer = f
+	if h != nil {
+		w = io.MultiWriter(f, h)
+	}
+	if _, err = io.Copy(w, d.rateLimitedReader(ctx, u.Host, checkTruncation(resp))); err != nil {
+		return err
+	}
+	if expected != nil {
+		if got := h.Sum(nil); !bytes.Equal(got, expected.sum) {
+			return fmt.Errorf("%w: expected %s, got %x", ErrChecksumMismatch, expected, got)
+		}
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), dst)
+}
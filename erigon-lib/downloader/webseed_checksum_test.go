@@ -0,0 +1,111 @@
+package downloader
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/ledgerwatch/erigon-lib/downloader/snaptype"
+	"github.com/stretchr/testify/require"
+	"lukechampine.com/blake3"
+)
+
+func TestWebSeedsDownloadFileChecksum(t *testing.T) {
+	require := require.New(t)
+	data := []byte("snapshot data")
+	sum := sha256.Sum256(data)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/good/a.seg.checksum":
+			_, _ = fmt.Fprintf(w, "%x  a.seg\n", sum)
+		case "/bad/a.seg.checksum":
+			_, _ = fmt.Fprintf(w, "sha256:%x", sha256.Sum256([]byte("other")))
+		case "/nosidecar/a.seg.checksum":
+			w.WriteHeader(http.StatusNotFound)
+		case "/blake3/a.seg.checksum":
+			_, _ = fmt.Fprintf(w, "blake3:%x", blake3.Sum256(data))
+		case "/unknown/a.seg.checksum":
+			_, _ = fmt.Fprintf(w, "md5:%x", md5.Sum(data))
+		default:
+			_, _ = w.Write(data)
+		}
+	}))
+	defer srv.Close()
+
+	checksumUrl, err := ChecksumUrl("https://a.com/a.seg?token=1")
+	require.NoError(err)
+	require.Equal("https://a.com/a.seg.checksum?token=1", checksumUrl)
+
+	dst := filepath.Join(t.TempDir(), "a.seg")
+	for _, c := range []struct {
+		urls []string
+		err  error
+	}{
+		{urls: []string{srv.URL + "/good/a.seg"}},
+		{urls: []string{srv.URL + "/nosidecar/a.seg"}},
+		{urls: []string{srv.URL + "/bad/a.seg"}, err: ErrChecksumMismatch},
+		{urls: []string{srv.URL + "/bad/a.seg", srv.URL + "/good/a.seg"}}, // next mirror
+		{urls: []string{srv.URL + "/blake3/a.seg"}},
+	} {
+		_ = os.Remove(dst)
+		ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedVerifyChecksum: true})
+		ws.Merge(snaptype.WebSeedUrls{"a.seg": c.urls}, nil)
+		err := ws.DownloadFile(context.Background(), "a.seg", dst)
+		if c.err != nil {
+			require.ErrorIs(err, c.err)
+			require.NoFileExists(dst)
+			continue
+		}
+		require.NoError(err)
+		onDisk, err := os.ReadFile(dst)
+		require.NoError(err)
+		require.Equal(data, onDisk)
+	}
+	entries, err := os.ReadDir(filepath.Dir(dst))
+	require.NoError(err)
+	require.Equal(1, len(entries)) // no leftover tmp files
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedVerifyChecksum: true})
+	ws.Merge(snaptype.WebSeedUrls{"a.seg": {srv.URL + "/unknown/a.seg"}}, nil)
+	require.ErrorContains(ws.DownloadFile(context.Background(), "a.seg", dst), "not supported checksum algorithm: md5")
+
+	c, err := parseChecksum([]byte(fmt.Sprintf("CRC32C:%08x", crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))))
+	require.NoError(err)
+	require.Equal("crc32c", c.algo)
+	_, err = parseChecksum([]byte(fmt.Sprintf("blake3:%x", sum))[:21])
+	require.ErrorContains(err, "invalid blake3 checksum length")
+
+	// checksum declared by manifest entry: sidecar not used
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	for _, c := range []struct {
+		url, checksum string
+		err           error
+	}{
+		{url: srv.URL + "/bad/a.seg", checksum: fmt.Sprintf("blake3:%x", blake3.Sum256(data))},
+		{url: srv.URL + "/bad/a.seg", checksum: fmt.Sprintf("%x", sum)}, // sha256
+		{url: srv.URL + "/good/a.seg", checksum: fmt.Sprintf("blake3:%x", blake3.Sum256([]byte("other"))), err: ErrChecksumMismatch},
+	} {
+		_ = os.Remove(dst)
+		require.NoError(os.WriteFile(manifest, []byte(fmt.Sprintf(`"a.seg" = { url = %q, checksum = %q }`, c.url, c.checksum)), 0644))
+		ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedVerifyChecksum: true})
+		ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+		err := ws.DownloadFile(context.Background(), "a.seg", dst)
+		if c.err != nil {
+			require.ErrorIs(err, c.err)
+			require.NoFileExists(dst)
+			continue
+		}
+		require.NoError(err)
+	}
+	_, err = decodeWebSeedsManifest(strings.NewReader(fmt.Sprintf(`"a.seg" = { url = "https://a.com/a.seg", checksum = "md5:%x" }`, md5.Sum(data))))
+	require.ErrorContains(err, "not supported checksum algorithm: md5")
+}
@@ -0,0 +1,288 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+)
+
+const defaultWebSeedMaxIdleConnsPerHost = 32
+
+// newWebSeedHttpClient - http client shared by http and s3 webseed providers
+func newWebSeedHttpClient(cfg *downloadercfg.Cfg) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = defaultWebSeedMaxIdleConnsPerHost
+	if cfg.WebSeedMaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = cfg.WebSeedMaxIdleConnsPerHost
+	}
+	if transport.MaxIdleConns < transport.MaxIdleConnsPerHost {
+		transport.MaxIdleConns = transport.MaxIdleConnsPerHost
+	}
+	transport.MaxConnsPerHost = cfg.WebSeedMaxConnsPerHost
+	if cfg.WebSeedProxy != "" {
+		proxyUrl, err := parseProxyUrl(cfg.WebSeedProxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+	if len(cfg.WebSeedPinnedSPKI) > 0 {
+		pins, err := parseSPKIPins(cfg.WebSeedPinnedSPKI)
+		if err != nil {
+			return nil, err
+		}
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.VerifyPeerCertificate = verifySPKIPins(pins)
+	}
+	if len(cfg.WebSeedResolveOverrides) > 0 {
+		dial, err := resolveOverrideDialer(transport.DialContext, cfg.WebSeedResolveOverrides)
+		if err != nil {
+			return nil, err
+		}
+		transport.DialContext = dial
+	}
+	if cfg.WebSeedClientCertFile != "" || cfg.WebSeedClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.WebSeedClientCertFile, cfg.WebSeedClientKeyFile) // also checks that key matches cert
+		if err != nil {
+			return nil, fmt.Errorf("webseed client certificate: %w", err)
+		}
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+	var roundTripper http.RoundTripper = transport
+	if len(cfg.WebSeedHostOverrides) > 0 {
+		roundTripper = &hostOverrideTransport{base: transport, overrides: cfg.WebSeedHostOverrides}
+	}
+	if cfg.WebSeedHTTP3 && cfg.WebSeedProxy == "" { // QUIC can't go through http proxy
+		roundTripper = newHttp3FallbackTransport(transport.TLSClientConfig, roundTripper, transport.Proxy, cfg.WebSeedHostOverrides, cfg.WebSeedResolveOverrides)
+	}
+	return &http.Client{Transport: roundTripper}, nil
+}
+
+// maxRedirects - same as default policy of http.Client
+const maxRedirects = 10
+
+// checkRedirect - each hop of redirect is checked same way as urls of manifests: allowed host provider can't redirect to other hosts,
+// and with requireHTTPS - https url can't be downgraded to cleartext
+func checkRedirect(allowedHosts *hostAllowlist, requireHTTPS bool) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		if !allowedHosts.allowed(req.URL.Hostname()) {
+			return fmt.Errorf("redirect to not allowed host: %s", req.URL.Hostname())
+		}
+		if requireHTTPS && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to %s url, while https is required", req.URL.Scheme)
+		}
+		return nil
+	}
+}
+
+// parseProxyUrl - errors never contain `s`: it may have credentials
+func parseProxyUrl(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("webseed proxy: invalid url")
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("webseed proxy: not supported scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("webseed proxy: no host in url")
+	}
+	return u, nil
+}
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// resolveOverrideDialer - dials pinned IP instead of resolving host. TLS still verifies certificate against host from url
+func resolveOverrideDialer(dial dialFunc, overrides map[string]string) (dialFunc, error) {
+	ips := make(map[string]string, len(overrides))
+	for host, ip := range overrides {
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid ip %q for host %q", ip, host)
+		}
+		ips[strings.ToLower(host)] = ip
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if ip, ok := ips[strings.ToLower(host)]; ok {
+			addr = net.JoinHostPort(ip, port)
+		}
+		return dial(ctx, network, addr)
+	}, nil
+}
+
+// hostOverrideTransport - TLS ServerName is taken by http.Transport from url host, not from `Host` header.
+// So hosts with overridden name use own copy of transport (created on first request).
+type hostOverrideTransport struct {
+	base      *http.Transport
+	overrides map[string]string // url host -> server name
+
+	lock       sync.Mutex
+	transports map[string]*http.Transport // by url host
+}
+
+func (t *hostOverrideTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	serverName, ok := t.overrides[host]
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+	t.lock.Lock()
+	transport, ok := t.transports[host]
+	if !ok {
+		transport = t.base.Clone()
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.ServerName = serverName
+		if t.transports == nil {
+			t.transports = map[string]*http.Transport{}
+		}
+		t.transports[host] = transport
+	}
+	t.lock.Unlock()
+	return transport.RoundTrip(req)
+}
+
+func (t *hostOverrideTransport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, transport := range t.transports {
+		transport.CloseIdleConnections()
+	}
+}
+
+func parseSPKIPins(pins []string) (map[[sha256.Size]byte]struct{}, error) {
+	res := make(map[[sha256.Size]byte]struct{}, len(pins))
+	for _, pin := range pins {
+		raw, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil {
+			return nil, fmt.Errorf("invalid spki pin %q: %w", pin, err)
+		}
+		if len(raw) != sha256.Size {
+			return nil, fmt.Errorf("invalid spki pin %q: expecting base64 of sha256, got %d bytes", pin, len(raw))
+		}
+		res[[sha256.Size]byte(raw)] = struct{}{}
+	}
+	return res, nil
+}
+
+// verifySPKIPins - runs after usual chain verification, so compromised CA can't issue certificate for our mirror.
+// Only certificates of verified chains are checked: server may send any extra (unchained) certificate
+func verifySPKIPins(pins map[[sha256.Size]byte]struct{}) func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	return func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+		for _, chain := range verifiedChains {
+			for _, cert := range chain {
+				if _, ok := pins[sha256.Sum256(cert.RawSubjectPublicKeyInfo)]; ok {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("webseed: none of certificates match pinned spki")
+	}
+}
+
+// doerFunc - adapter to pass WebSeeds.do as aws `config.HTTPClient`
+type doerFunc func(*http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(r *http.Request) (*http.Response, error) { return f(r) }
+
+// requestAccounting - which shared state of WebSeeds requests feed, see withAccounting
+type requestAccounting int
+
+const (
+	accountAll           requestAccounting = iota // Discover runs: byte budget, latency, weights of hosts
+	accountObservability                          // Verify: latency and weights, not byte budget of Discover runs
+	accountNone                                   // SelfTest: nothing, diagnostic must not change state of node
+)
+
+type accountingKey struct{}
+
+// withAccounting - requests made with returned ctx (also by s3 client) feed only what `a` allows
+func withAccounting(ctx context.Context, a requestAccounting) context.Context {
+	return context.WithValue(ctx, accountingKey{}, a)
+}
+
+func accountingOf(ctx context.Context) requestAccounting {
+	a, _ := ctx.Value(accountingKey{}).(requestAccounting)
+	return a
+}
+
+// do - all requests to providers (including s3 client) go through it
+func (d *WebSeeds) do(request *http.Request) (*http.Response, error) {
+	resp, err := d.doWithRetries(request)
+	if err == nil && d.byteBudget > 0 && accountingOf(request.Context()) == accountAll {
+		resp.Body = &budgetBody{ReadCloser: resp.Body, d: d}
+	}
+	return resp, err
+}
+
+// doAttempt - 1 attempt of request, see doWithRetries
+func (d *WebSeeds) doAttempt(request *http.Request) (*http.Response, error) {
+	if err := d.waitRequestRate(request.Context(), request.URL.Host); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := d.doTraced(request)
+	if accountingOf(request.Context()) != accountNone {
+		d.observeLatency(request.URL.Host, time.Since(start))
+		d.observeHostResult(request, resp, err)
+	}
+	return resp, err
+}
+
+func (d *WebSeeds) doTraced(request *http.Request) (*http.Response, error) {
+	lvl, detailed := d.requestVerbosity(request.URL)
+	if !detailed {
+		return d.httpClient.Do(request)
+	}
+	start := time.Now()
+	resp, err := d.httpClient.Do(request)
+	took := time.Since(start)
+	if err != nil {
+		d.logger.Log(lvl, "[snapshots] webseed trace", "method", request.Method, "url", redactUrl(request.URL), "err", err, "took", took)
+		return resp, err
+	}
+	d.logger.Log(lvl, "[snapshots] webseed trace", "method", request.Method, "url", redactUrl(request.URL), "status", resp.StatusCode,
+		"etag", resp.Header.Get("ETag"), "content-length", resp.ContentLength, "content-type", resp.Header.Get("Content-Type"), "proto", resp.Proto, "took", took)
+	return resp, nil
+}
+
+// redactUrl - signed urls carry secrets in query, basic-auth - in userinfo
+func redactUrl(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	redacted := url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}
+	if u.User != nil {
+		redacted.User = url.User("xxxxx")
+	}
+	if u.RawQuery != "" {
+		redacted.RawQuery = "xxxxx"
+	}
+	return redacted.String()
+}
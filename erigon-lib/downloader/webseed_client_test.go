@@ -0,0 +1,252 @@
+package downloader
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	stdlog "log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestWebSeedsSPKIPinning(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `"a.seg" = "https://127.0.0.1/a.seg"`)
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	sum := sha256.Sum256(srv.Certificate().RawSubjectPublicKeyInfo)
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedPinnedSPKI: []string{base64.StdEncoding.EncodeToString(sum[:])}})
+	trustTestServer(ws, srv)
+	res, err := ws.callHttpProvider(ctx, u)
+	require.NoError(t, err)
+	require.Equal(t, "https://127.0.0.1/a.seg", res.files["a.seg"])
+
+	other := sha256.Sum256([]byte("other"))
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedPinnedSPKI: []string{base64.StdEncoding.EncodeToString(other[:])}})
+	trustTestServer(ws, srv)
+	_, err = ws.callHttpProvider(ctx, u)
+	require.ErrorContains(t, err, "pinned spki")
+
+	_, err = NewWebSeeds(&downloadercfg.Cfg{WebSeedPinnedSPKI: []string{"not-base64"}}, log.New(), log.LvlInfo)
+	require.Error(t, err)
+
+	// extra certificate, not part of verified chain, carries pinned key: rejected
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "pinned"}, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	extra, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	extraCert, err := x509.ParseCertificate(extra)
+	require.NoError(t, err)
+	srv.TLS.Certificates[0].Certificate = append(srv.TLS.Certificates[0].Certificate, extra)
+	pinned := sha256.Sum256(extraCert.RawSubjectPublicKeyInfo)
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedPinnedSPKI: []string{base64.StdEncoding.EncodeToString(pinned[:])}})
+	trustTestServer(ws, srv)
+	_, err = ws.callHttpProvider(ctx, u)
+	require.ErrorContains(t, err, "pinned spki")
+}
+
+// BenchmarkWebSeedsConnPool - bursty discovery: many parallel small requests to same host.
+// Compare `go test -run=none -bench=ConnPool -cpu=4`: with go's default pool (2 idle) many requests dial new connection (TLS handshake).
+func BenchmarkWebSeedsConnPool(b *testing.B) {
+	var dials atomic.Int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("d8:announce0:e"))
+	}))
+	srv.Config.ErrorLog = stdlog.New(io.Discard, "", 0)
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			dials.Add(1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	for _, bc := range []struct {
+		name    string
+		idleMax int
+	}{{"go_default", 2}, {"default", 0}, {"idle_128", 128}} {
+		b.Run(bc.name, func(b *testing.B) {
+			ws, err := NewWebSeeds(&downloadercfg.Cfg{WebSeedMaxIdleConnsPerHost: bc.idleMax}, log.New(), log.LvlInfo)
+			if err != nil {
+				b.Fatal(err)
+			}
+			trustTestServer(ws, srv)
+			defer ws.httpClient.CloseIdleConnections()
+			dials.Store(0)
+			b.ResetTimer()
+			var g errgroup.Group
+			g.SetLimit(32)
+			for i := 0; i < b.N; i++ {
+				g.Go(func() error {
+					resp, err := ws.httpClient.Get(srv.URL)
+					if err != nil {
+						return err
+					}
+					defer resp.Body.Close()
+					_, err = io.Copy(io.Discard, resp.Body)
+					return err
+				})
+			}
+			if err := g.Wait(); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(float64(dials.Load())/float64(b.N), "dials/op")
+		})
+	}
+}
+
+func TestWebSeedsHostOverride(t *testing.T) {
+	require := require.New(t)
+	var host, serverName string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, serverName = r.Host, r.TLS.ServerName
+		_, _ = w.Write([]byte(`"a.seg" = "https://a.com/a.seg"`))
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL + "/webseeds.toml")
+	require.NoError(err)
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedHostOverrides: map[string]string{u.Hostname(): "example.com"}}) // httptest cert is valid for example.com
+	trustTestServer(ws, srv)
+	_, err = ws.callHttpProvider(context.Background(), u)
+	require.NoError(err)
+	require.Equal("example.com", host)
+	require.Equal("example.com", serverName)
+}
+
+func TestWebSeedsClientCert(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "erigon"}, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	certDer, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(err)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDer}), 0644))
+	require.NoError(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	var clientCN string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientCN = r.TLS.PeerCertificates[0].Subject.CommonName
+		_, _ = w.Write([]byte(`"a.seg" = "https://a.com/a.seg"`))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+	u, err := url.Parse(srv.URL + "/webseeds.toml")
+	require.NoError(err)
+
+	ws := newTestWebSeeds(t, nil)
+	trustTestServer(ws, srv)
+	_, err = ws.callHttpProvider(context.Background(), u)
+	require.Error(err)
+
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedClientCertFile: certFile, WebSeedClientKeyFile: keyFile})
+	trustTestServer(ws, srv)
+	_, err = ws.callHttpProvider(context.Background(), u)
+	require.NoError(err)
+	require.Equal("erigon", clientCN)
+
+	// key doesn't match cert
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	otherKeyDer, err := x509.MarshalECPrivateKey(otherKey)
+	require.NoError(err)
+	require.NoError(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: otherKeyDer}), 0600))
+	_, err = NewWebSeeds(&downloadercfg.Cfg{WebSeedClientCertFile: certFile, WebSeedClientKeyFile: keyFile}, log.New(), log.LvlInfo)
+	require.Error(err)
+}
+
+func TestWebSeedsResolveOverride(t *testing.T) {
+	require := require.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`"a.seg" = "https://a.com/a.seg"`))
+	}))
+	defer srv.Close()
+	srvUrl, err := url.Parse(srv.URL)
+	require.NoError(err)
+
+	_, err = NewWebSeeds(&downloadercfg.Cfg{WebSeedResolveOverrides: map[string]string{"mirror.invalid": "not-ip"}}, log.New(), log.LvlInfo)
+	require.Error(err)
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedResolveOverrides: map[string]string{"mirror.invalid": srvUrl.Hostname()}})
+	u, err := url.Parse("http://mirror.invalid:" + srvUrl.Port() + "/webseeds.toml")
+	require.NoError(err)
+	m, err := ws.callHttpProvider(context.Background(), u)
+	require.NoError(err)
+	require.Equal(1, len(m.files))
+}
+
+func TestWebSeedsTrace(t *testing.T) {
+	require := require.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/toml")
+		_, _ = w.Write([]byte(`"a.seg" = "https://a.com/a.seg"`))
+	}))
+	defer srv.Close()
+	u, err := url.Parse(strings.Replace(srv.URL, "http://", "http://user:secret@", 1) + "/webseeds.toml?X-Amz-Signature=secret")
+	require.NoError(err)
+
+	var records []*log.Record
+	capture := log.FuncHandler(func(r *log.Record) error {
+		if r.Msg == "[snapshots] webseed trace" {
+			records = append(records, r)
+		}
+		return nil
+	})
+	ws := newTestWebSeeds(t, nil)
+	ws.logger.SetHandler(capture)
+	_, err = ws.callHttpProviderPage(context.Background(), u)
+	require.NoError(err)
+	require.Empty(records) // disabled by default
+
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedTrace: true})
+	ws.logger.SetHandler(capture)
+	_, err = ws.callHttpProviderPage(context.Background(), u)
+	require.NoError(err)
+	require.Equal(1, len(records))
+	kv := map[string]interface{}{}
+	for i := 0; i+1 < len(records[0].Ctx); i += 2 {
+		kv[records[0].Ctx[i].(string)] = records[0].Ctx[i+1]
+	}
+	require.Equal(ws.verbosity, records[0].Lvl)
+	require.Equal(strings.Replace(srv.URL, "http://", "http://xxxxx@", 1)+"/webseeds.toml?xxxxx", kv["url"])
+	require.NotContains(fmt.Sprint(records[0].Ctx), "secret")
+	require.Equal(http.StatusOK, kv["status"])
+	require.Equal(`"v1"`, kv["etag"])
+	require.Equal("application/toml", kv["content-type"])
+	require.Equal(int64(len(`"a.seg" = "https://a.com/a.seg"`)), kv["content-length"])
+	require.Contains(kv, "took")
+}
@@ -0,0 +1,83 @@
+package downloader
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// clockSkewThreshold - S3/R2 reject signatures with timestamp more than 15min away from server time,
+// smaller skew is not enough to break signed urls but still worth to report together with 403
+const clockSkewThreshold = time.Minute
+
+// clockSkewErrCodes - S3-compatible error codes which are caused by wrong time on client side
+var clockSkewErrCodes = map[string]struct{}{
+	"RequestTimeTooSkewed": {},
+	"RequestExpired":       {},
+	"ExpiredToken":         {},
+}
+
+var s3ErrCodeRe = regexp.MustCompile(`<Code>([^<]+)</Code>`)
+
+// isClockSkew - server time taken from `Date` header, errCode - from body of S3-compatible error response (may be empty)
+func isClockSkew(status int, errCode string, serverTime, localTime time.Time) bool {
+	if _, ok := clockSkewErrCodes[errCode]; ok {
+		return true
+	}
+	if status != http.StatusForbidden || serverTime.IsZero() {
+		return false
+	}
+	skew := serverTime.Sub(localTime)
+	return skew > clockSkewThreshold || skew < -clockSkewThreshold
+}
+
+func (d *WebSeeds) warnClockSkew(u *url.URL, status int, errCode string, header http.Header) {
+	localTime := time.Now()
+	serverTime, _ := http.ParseTime(header.Get("Date"))
+	if !isClockSkew(status, errCode, serverTime, localTime) {
+		return
+	}
+	args := []any{"url", redactUrl(u), "status", status, "code", errCode, "localTime", localTime.UTC().Format(time.RFC3339)}
+	if !serverTime.IsZero() {
+		args = append(args, "serverTime", serverTime.UTC().Format(time.RFC3339), "skew", serverTime.Sub(localTime).Round(time.Second))
+	}
+	d.logger.Warn("[snapshots] webseed provider rejected signed request, possible clock skew: check NTP", args...)
+}
+
+// checkClockSkewResp - for non-200 responses of http providers. Reads beginning of body to find S3 error code
+func (d *WebSeeds) checkClockSkewResp(u *url.URL, resp *http.Response) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusBadRequest {
+		return
+	}
+	var errCode string
+	if body, err := io.ReadAll(io.LimitReader(resp.Body, 4*1024)); err == nil {
+		if m := s3ErrCodeRe.FindSubmatch(body); m != nil {
+			errCode = string(m[1])
+		}
+	}
+	d.warnClockSkew(u, resp.StatusCode, errCode, resp.Header)
+}
+
+// checkClockSkewS3 - for errors of s3 client
+func (d *WebSeeds) checkClockSkewS3(err error) {
+	var respErr *smithyhttp.ResponseError
+	if !errors.As(err, &respErr) || respErr.Response == nil {
+		return
+	}
+	var errCode string
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		errCode = apiErr.ErrorCode()
+	}
+	u := &url.URL{Scheme: "s3"}
+	if respErr.Response.Request != nil {
+		u = respErr.Response.Request.URL
+	}
+	d.warnClockSkew(u, respErr.Response.StatusCode, errCode, respErr.Response.Header)
+}
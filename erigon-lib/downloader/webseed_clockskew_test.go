@@ -0,0 +1,19 @@
+package downloader
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsClockSkew(t *testing.T) {
+	require := require.New(t)
+	now := time.Now()
+	require.True(isClockSkew(http.StatusForbidden, "RequestTimeTooSkewed", time.Time{}, now))
+	require.True(isClockSkew(http.StatusForbidden, "AccessDenied", now.Add(-time.Hour), now))
+	require.False(isClockSkew(http.StatusForbidden, "AccessDenied", now.Add(time.Second), now))
+	require.False(isClockSkew(http.StatusNotFound, "", now.Add(time.Hour), now))
+	require.False(isClockSkew(http.StatusForbidden, "", time.Time{}, now))
+}
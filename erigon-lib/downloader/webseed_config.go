@@ -0,0 +1,162 @@
+package downloader
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+// Config - effective configuration: after defaults applied by NewWebSeeds, with current providers (see SetProviders).
+// Secrets are redacted: s3 tokens shown as bucket/key, urls without userinfo and query, tokens as "set".
+// Flat map of json-compatible values, for logging (`logger.Info("webseeds", "cfg", ws.Config())`) or admin api
+func (d *WebSeeds) Config() map[string]any {
+	d.lock.Lock()
+	providers := d.providers
+	var expectedHosts []string
+	if d.expectedHosts != nil {
+		expectedHosts = append(expectedHosts, d.expectedHosts.patterns...)
+	}
+	d.lock.Unlock()
+
+	s3Providers := make([]string, 0, len(providers.s3tokens))
+	for _, token := range providers.s3tokens {
+		s3Providers = append(s3Providers, d.s3ProviderName(token))
+	}
+	httpProviders := make([]string, 0, len(providers.urls))
+	for _, u := range providers.urls {
+		httpProviders = append(httpProviders, redactUrl(u))
+	}
+	latestMarkers := make(map[string]string, len(d.latestMarkers))
+	for provider, marker := range d.latestMarkers {
+		latestMarkers[redactRawUrl(provider)] = redactRawUrl(marker)
+	}
+
+	providerVerbosity := make(map[string]string, len(d.providerVerbosity))
+	for host, lvl := range d.providerVerbosity {
+		providerVerbosity[host] = lvl.String()
+	}
+	res := map[string]any{
+		"chain":                    d.chainName,
+		"user_agent":               d.userAgent,
+		"providers_s3":             s3Providers,
+		"providers_http":           httpProviders,
+		"providers_files":          append([]string(nil), providers.files...),
+		"files_filter":             append([]string(nil), d.filesFilter...),
+		"fallback_file":            d.fallbackFile,
+		"disable_fallback":         d.disableFallback,
+		"disable_s3":               d.disableS3,
+		"s3_credentials_provider":  d.s3Credentials != nil,
+		"s3_checksum_validation":   int(d.s3ChecksumValidation),
+		"s3_max_manifest_age":      d.s3MaxManifestAge.String(),
+		"ssh_key_file":             d.sshKeyFile,
+		"ssh_known_hosts":          d.sshKnownHosts,
+		"git_token":                secretSet(d.gitToken),
+		"merge_strategy":           int(d.mergeStrategy),
+		"strict_schema":            d.strictSchema,
+		"allowed_hosts":            d.allowedHosts != nil,
+		"check_torrent_urls":       d.checkTorrentUrls,
+		"expected_hosts":           expectedHosts,
+		"expected_hosts_check":     int(d.expectedHostsCheck),
+		"require_https":            d.requireHTTPS,
+		"host_overrides":           copyMap(d.hostOverrides),
+		"host_weights":             copyMap(d.hostWeights),
+		"weight_decay":             d.weightDecay,
+		"weight_recovery":          d.weightRecovery,
+		"capability_probe":         d.capabilityProbe,
+		"provider_time_budget":     int(d.providerTimeBudget),
+		"provider_timeout":         d.providerTimeout.String(),
+		"provider_min_timeout":     d.providerMinTimeout.String(),
+		"retries":                  d.retries,
+		"retry_backoff":            d.retryBackoff.String(),
+		"request_rate_limited":     d.requestLimiter != nil,
+		"host_request_rate":        d.hostRequestRate,
+		"download_rate_limited":    d.globalLimiter != nil,
+		"discovery_byte_budget":    d.byteBudget.HR(),
+		"freshness_check":          int(d.freshnessCheck),
+		"latest_markers":           latestMarkers,
+		"min_successful_providers": d.minSuccessfulProviders,
+		"max_manifest_entries":     d.maxManifestEntries,
+		"max_total_entries":        d.maxTotalEntries,
+		"manifest_resumes":         d.manifestResumes,
+		"recent_errors":            d.recentErrors.capacity(),
+		"download_torrent_files":   d.downloadTorrentFile,
+		"torrent_head_preflight":   d.torrentHeadPreflight,
+		"torrent_consistency":      d.torrentConsistencySample,
+		"should_download_hook":     d.shouldDownload != nil,
+		"torrents_by_size":         d.torrentsBySize,
+		"torrents_index":           d.torrentsIndex,
+		"torrents_etag":            d.torrentsETag,
+		"torrents_cutoff_block":    d.cutoffBlock,
+		"torrents_max_duration":    d.torrentsMaxDuration.String(),
+		"size_consistency":         d.sizeConsistencySample,
+		"verify_checksum":          d.verifyChecksum,
+		"report":                   d.reportWriter != nil,
+		"skip_log_level":           d.skipLogLevel.String(),
+		"trace":                    d.trace,
+		"provider_verbosity":       providerVerbosity,
+	}
+	for k, v := range transportConfig(d.httpClient) {
+		res[k] = v
+	}
+	return res
+}
+
+// ConfigLogCtx - Config as sorted key-value pairs, for `logger.Info("[snapshots] webseeds config", ws.ConfigLogCtx()...)`
+func (d *WebSeeds) ConfigLogCtx() []interface{} {
+	cfg := d.Config()
+	keys := make([]string, 0, len(cfg))
+	for k := range cfg {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	res := make([]interface{}, 0, 2*len(keys))
+	for _, k := range keys {
+		res = append(res, k, cfg[k])
+	}
+	return res
+}
+
+// transportConfig - settings of http client, if its transport is one built by newWebSeedHttpClient
+func transportConfig(client *http.Client) map[string]any {
+	res := map[string]any{"http3": false}
+	rt := client.Transport
+	if h3, ok := rt.(*http3FallbackTransport); ok {
+		res["http3"] = true
+		rt = h3.fallback
+	}
+	if o, ok := rt.(*hostOverrideTransport); ok {
+		rt = o.base
+	}
+	t, ok := rt.(*http.Transport)
+	if !ok {
+		return res
+	}
+	res["max_idle_conns_per_host"] = t.MaxIdleConnsPerHost
+	res["max_conns_per_host"] = t.MaxConnsPerHost
+	res["client_certificate"] = t.TLSClientConfig != nil && len(t.TLSClientConfig.Certificates) > 0
+	res["pinned_spki"] = t.TLSClientConfig != nil && t.TLSClientConfig.VerifyPeerCertificate != nil
+	return res
+}
+
+func secretSet(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "set"
+}
+
+func redactRawUrl(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "<invalid url>"
+	}
+	return redactUrl(u)
+}
+
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	res := make(map[K]V, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
@@ -0,0 +1,71 @@
+package downloader
+
+import (
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// dedupProviders - same provider passed twice would be contacted twice and its entries counted twice. Order of first occurrences kept
+func (d *WebSeeds) dedupProviders(s3Providers []string, httpProviders []*url.URL, diskProviders []string) ([]string, []*url.URL, []string) {
+	s3Providers = dedupBy(s3Providers, strings.TrimSpace, func(token string) {
+		d.logger.Warn("[snapshots] duplicate s3 webseed provider, ignoring it", "provider", d.s3ProviderName(token))
+	})
+	httpProviders = dedupBy(httpProviders, normalizeProviderUrl, func(u *url.URL) {
+		d.logger.Warn("[snapshots] duplicate webseed provider, ignoring it", "url", redactUrl(u))
+	})
+	diskProviders = dedupBy(diskProviders, normalizeProviderPath, func(path string) {
+		d.logger.Warn("[snapshots] duplicate webseed file, ignoring it", "file", path)
+	})
+	return s3Providers, httpProviders, diskProviders
+}
+
+func dedupBy[T any](list []T, key func(T) string, onDuplicate func(T)) []T {
+	if len(list) < 2 {
+		return list
+	}
+	seen := make(map[string]struct{}, len(list))
+	res := make([]T, 0, len(list))
+	for _, v := range list {
+		k := key(v)
+		if _, ok := seen[k]; ok {
+			onDuplicate(v)
+			continue
+		}
+		seen[k] = struct{}{}
+		res = append(res, v)
+	}
+	return res
+}
+
+// normalizeProviderUrl - for comparison only, requests use url as given: scheme and host are case-insensitive,
+// default port is same as no port, empty path is "/", order of query params and fragment don't matter
+func normalizeProviderUrl(u *url.URL) string {
+	n := *u
+	n.Scheme = strings.ToLower(u.Scheme)
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (n.Scheme == "http" && port == "80") || (n.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	n.Host = host
+	if port != "" {
+		n.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") { // ipv6
+		n.Host = "[" + host + "]"
+	}
+	if n.Path == "" {
+		n.Path = "/"
+	}
+	n.RawPath = ""
+	n.RawQuery = u.Query().Encode() // sorted by key
+	n.Fragment, n.RawFragment = "", ""
+	return n.String()
+}
+
+func normalizeProviderPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
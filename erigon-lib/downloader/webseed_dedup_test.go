@@ -0,0 +1,48 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsDedupProviders(t *testing.T) {
+	require := require.New(t)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = w.Write([]byte(`"a.seg" = "https://example.com/a.seg"`))
+	}))
+	defer srv.Close()
+	parse := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		require.NoError(err)
+		return u
+	}
+	host := strings.TrimPrefix(srv.URL, "http://")
+	urls := []*url.URL{
+		parse(srv.URL + "/webseeds.toml?a=1&b=2"),
+		parse("HTTP://" + host + "/webseeds.toml?b=2&a=1#x"),
+		parse(srv.URL + "/webseeds.toml?a=1&b=2"),
+		parse(srv.URL + "/other.toml"),
+	}
+	file := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(file, []byte(`"b.seg" = "https://example.com/b.seg"`), 0644))
+
+	ws := newTestWebSeeds(t, nil)
+	require.NoError(ws.downloadWebseedTomlFromProviders(context.Background(), nil, urls, []string{file, filepath.Join(filepath.Dir(file), ".", "webseeds.toml")}))
+	require.EqualValues(2, calls.Load())
+	require.Equal(map[string]int{redactUrl(urls[0]): 1, redactUrl(urls[3]): 1, file: 1}, ws.Stats().ProviderEntries)
+
+	require.Equal(normalizeProviderUrl(parse("https://Example.com:443")), normalizeProviderUrl(parse("https://example.com/")))
+	require.Equal(normalizeProviderUrl(parse("http://[::1]:80/x")), normalizeProviderUrl(parse("http://[::1]/x")))
+	require.NotEqual(normalizeProviderUrl(parse("http://example.com:8080/x")), normalizeProviderUrl(parse("http://example.com/x")))
+}
@@ -0,0 +1,59 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// errDiskCapacityUnknown - OS doesn't expose filesystem stats, check skipped
+var errDiskCapacityUnknown = errors.New("disk capacity unknown")
+
+const (
+	// torrentFileSizeEstimate - for .torrent files of unknown size: enough for data file of ~100Gb
+	torrentFileSizeEstimate = 256 * datasize.KB
+	minFreeDiskReserve      = 64 * datasize.MB // left for other writers
+	minFreeInodesReserve    = 1024
+)
+
+type diskCapacity struct {
+	freeBytes   uint64
+	freeInodes  uint64
+	inodesKnown bool // some filesystems (btrfs, zfs) have no fixed amount of inodes
+}
+
+// checkTorrentsDiskCapacity - before bulk download of .torrent files: ext4 tuned for large files (`-T largefile`) may
+// run out of inodes with plenty of free bytes. Best-effort: if OS doesn't expose stats - no error
+func (d *WebSeeds) checkTorrentsDiskCapacity(rootDir string, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	c, err := d.diskCapacityOf(rootDir)
+	if errors.Is(err, errDiskCapacityUnknown) {
+		return nil
+	}
+	if err != nil {
+		d.logger.Debug("[snapshots] can't get disk capacity", "dir", rootDir, "err", err)
+		return nil
+	}
+	if c.inodesKnown && c.freeInodes < uint64(len(names))+minFreeInodesReserve {
+		return fmt.Errorf("not enough free inodes: have %d, need %d (+%d reserve)", c.freeInodes, len(names), minFreeInodesReserve)
+	}
+	d.lock.Lock()
+	sizes := d.sizes
+	d.lock.Unlock()
+	var need datasize.ByteSize
+	for _, name := range names {
+		if size, ok := sizes[name]; ok && strings.HasSuffix(name, ".torrent") {
+			need += size
+			continue
+		}
+		need += torrentFileSizeEstimate
+	}
+	if c.freeBytes < uint64(need+minFreeDiskReserve) {
+		return fmt.Errorf("not enough free space: have %s, need %s (+%s reserve)", datasize.ByteSize(c.freeBytes).HR(), need.HR(), minFreeDiskReserve.HR())
+	}
+	return nil
+}
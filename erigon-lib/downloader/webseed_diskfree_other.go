@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package downloader
+
+func getDiskCapacity(dir string) (diskCapacity, error) {
+	return diskCapacity{}, errDiskCapacityUnknown
+}
@@ -0,0 +1,53 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsDiskCapacity(t *testing.T) {
+	require := require.New(t)
+	var downloads atomic.Int32
+	torrent := testTorrentBytes(t, "a.seg")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		_, _ = w.Write(torrent)
+	}))
+	defer srv.Close()
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(fmt.Sprintf(`"a.seg.torrent" = "%s/a.seg.torrent"`, srv.URL)), 0644))
+
+	for _, c := range []struct {
+		capacity diskCapacity
+		err      error
+		download bool
+	}{
+		{capacity: diskCapacity{freeBytes: uint64(datasize.GB), freeInodes: 10, inodesKnown: true}},                  // no inodes
+		{capacity: diskCapacity{freeBytes: uint64(datasize.MB), freeInodes: 1_000_000, inodesKnown: true}},           // no space
+		{capacity: diskCapacity{freeBytes: uint64(datasize.GB), freeInodes: 10, inodesKnown: false}, download: true}, // btrfs
+		{err: errDiskCapacityUnknown, download: true},                                                                // windows
+		{capacity: diskCapacity{freeBytes: uint64(datasize.GB), freeInodes: 1_000_000, inodesKnown: true}, download: true},
+	} {
+		downloads.Store(0)
+		ws := newTestWebSeeds(t, nil)
+		ws.downloadTorrentFile = true
+		ws.diskCapacityOf = func(string) (diskCapacity, error) { return c.capacity, c.err }
+		ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+		ws.downloadTorrentFilesFromProviders(context.Background(), t.TempDir())
+		require.Equal(c.download, downloads.Load() == 1, "%+v", c)
+	}
+
+	c, err := getDiskCapacity(t.TempDir())
+	if err == nil {
+		require.Greater(c.freeBytes, uint64(0))
+	}
+}
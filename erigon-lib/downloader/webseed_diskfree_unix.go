@@ -0,0 +1,17 @@
+//go:build linux || darwin
+
+package downloader
+
+import "golang.org/x/sys/unix"
+
+func getDiskCapacity(dir string) (diskCapacity, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return diskCapacity{}, err
+	}
+	return diskCapacity{
+		freeBytes:   uint64(st.Bavail) * uint64(st.Bsize),
+		freeInodes:  uint64(st.Ffree),
+		inodesKnown: st.Files > 0,
+	}, nil
+}
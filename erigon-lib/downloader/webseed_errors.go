@@ -0,0 +1,111 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// ProviderErrCategory - nature of webseed provider failure
+type ProviderErrCategory string
+
+const (
+	ProviderErrDNS     ProviderErrCategory = "dns"
+	ProviderErrConnect ProviderErrCategory = "connect"
+	ProviderErrTimeout ProviderErrCategory = "timeout"
+	ProviderErrStatus  ProviderErrCategory = "status" // provider responded with unexpected http status
+	ProviderErrParse   ProviderErrCategory = "parse"  // manifest is not valid
+	ProviderErrOther   ProviderErrCategory = "other"
+)
+
+var AllProviderErrCategories = []ProviderErrCategory{ProviderErrDNS, ProviderErrConnect, ProviderErrTimeout, ProviderErrStatus, ProviderErrParse, ProviderErrOther}
+
+// ErrTruncatedResponse - connection dropped before declared Content-Length received. Distinguishes network truncation from invalid content
+var ErrTruncatedResponse = errors.New("truncated response")
+
+// ErrNotEnoughProviders - less than WebSeedMinSuccessfulProviders providers returned valid manifest
+var ErrNotEnoughProviders = errors.New("not enough webseed providers succeeded")
+
+// ErrManifestRejected - provider answered, but its manifest didn't pass validation (schema, chain, amount of entries), see logs
+var ErrManifestRejected = errors.New("webseed manifest rejected by validation")
+
+// ErrPartialContent - 206 on request without Range: misbehaving provider or caching proxy, body is only part of file
+var ErrPartialContent = errors.New("partial content on non-ranged request")
+
+// checkPartialContent - all our requests are non-ranged, so 206 is never expected
+func checkPartialContent(resp *http.Response) error {
+	if resp.StatusCode == http.StatusPartialContent && resp.Request.Header.Get("Range") == "" {
+		return newProviderErr(ProviderErrStatus, fmt.Errorf("%w: %s", ErrPartialContent, resp.Header.Get("Content-Range")))
+	}
+	return nil
+}
+
+// truncationCheckReader - http client already returns io.ErrUnexpectedEOF on short body, but it's easy to confuse with parsing errors
+type truncationCheckReader struct {
+	r        io.Reader
+	expected int64 // declared Content-Length, -1 - unknown
+	read     int64
+}
+
+func checkTruncation(resp *http.Response) io.Reader {
+	return &truncationCheckReader{r: resp.Body, expected: resp.ContentLength}
+}
+
+func (t *truncationCheckReader) Read(p []byte) (n int, err error) {
+	n, err = t.r.Read(p)
+	t.read += int64(n)
+	if errors.Is(err, io.ErrUnexpectedEOF) || (err == io.EOF && t.expected >= 0 && t.read != t.expected) {
+		return n, fmt.Errorf("%w: got %d of %d bytes", ErrTruncatedResponse, t.read, t.expected)
+	}
+	return n, err
+}
+
+// ProviderError - returned by call*Provider methods, allows callers branch by errors.As
+type ProviderError struct {
+	Category ProviderErrCategory
+	Err      error
+}
+
+func (e *ProviderError) Error() string { return fmt.Sprintf("%s: %s", e.Category, e.Err) }
+func (e *ProviderError) Unwrap() error { return e.Err }
+
+func newProviderErr(category ProviderErrCategory, err error) error {
+	return &ProviderError{Category: category, Err: err}
+}
+
+// classifyNetworkErr - for errors of http/s3 client
+func classifyNetworkErr(err error) error {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return err
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return newProviderErr(ProviderErrDNS, err)
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return newProviderErr(ProviderErrTimeout, err)
+	}
+	var statusErr interface{ HTTPStatusCode() int } // aws sdk errors
+	if errors.As(err, &statusErr) {
+		return newProviderErr(ProviderErrStatus, err)
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return newProviderErr(ProviderErrConnect, err)
+	}
+	return newProviderErr(ProviderErrOther, err)
+}
+
+// ProviderErrCategoryOf - ProviderErrOther if err is not ProviderError
+func ProviderErrCategoryOf(err error) ProviderErrCategory {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.Category
+	}
+	return ProviderErrOther
+}
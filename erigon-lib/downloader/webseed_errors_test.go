@@ -0,0 +1,68 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsProviderErrCategory(t *testing.T) {
+	require := require.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `not a toml`)
+	}))
+	defer srv.Close()
+	base, err := url.Parse(srv.URL)
+	require.NoError(err)
+	ws := newTestWebSeeds(t, nil)
+
+	_, err = ws.callHttpProvider(context.Background(), base.JoinPath("missing"))
+	require.Equal(ProviderErrStatus, ProviderErrCategoryOf(err))
+	_, err = ws.callHttpProvider(context.Background(), base.JoinPath("webseeds.toml"))
+	require.Equal(ProviderErrParse, ProviderErrCategoryOf(err))
+
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, []*url.URL{base.JoinPath("missing"), base.JoinPath("webseeds.toml")}, nil)
+	stats := ws.Stats()
+	require.Equal(1, stats.ProviderErrors[ProviderErrStatus])
+	require.Equal(1, stats.ProviderErrors[ProviderErrParse])
+}
+
+func TestWebSeedsPartialContent(t *testing.T) {
+	require := require.New(t)
+	manifest := []byte(`"a.seg" = "https://a.com/a.seg"
+"b.seg" = "https://a.com/b.seg"`)
+	torrent := testTorrentBytes(t, "a.seg")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := manifest
+		if strings.HasSuffix(r.URL.Path, ".torrent") {
+			body = torrent
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(body)/2-1, len(body)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(body[:len(body)/2])
+	}))
+	defer srv.Close()
+	ws := newTestWebSeeds(t, nil)
+
+	u, err := url.Parse(srv.URL + "/webseeds.toml")
+	require.NoError(err)
+	_, err = ws.callHttpProvider(context.Background(), u)
+	require.ErrorIs(err, ErrPartialContent)
+	require.Equal(ProviderErrStatus, ProviderErrCategoryOf(err))
+
+	u, err = url.Parse(srv.URL + "/a.seg.torrent")
+	require.NoError(err)
+	_, err = ws.callTorrentHttpProvider(context.Background(), u, filepath.Join(t.TempDir(), "a.seg.torrent"))
+	require.ErrorIs(err, ErrPartialContent)
+}
@@ -0,0 +1,90 @@
+package downloader
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// torrentETagsFileName - in rootDir, next to .torrent files. Doesn't match snapshot files naming, so ignored by snaptype.ParseDir
+const torrentETagsFileName = ".webseed-etags.json"
+
+// errNotModified - server confirmed (by If-None-Match) that .torrent file on disk is up to date
+var errNotModified = errors.New("not modified")
+
+// torrentETags - ETag of .torrent file by url it was downloaded from. Different mirrors may have different ETags for same file
+type torrentETags struct {
+	lock  sync.Mutex
+	byUrl map[string]string
+}
+
+// etagKey - url without query: signed urls have new signature on each run
+func etagKey(u *url.URL) string {
+	return u.Scheme + "://" + u.Host + u.Path
+}
+
+func (e *torrentETags) get(u *url.URL) string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.byUrl[etagKey(u)]
+}
+
+func (e *torrentETags) set(u *url.URL, etag string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if etag == "" {
+		delete(e.byUrl, etagKey(u))
+		return
+	}
+	e.byUrl[etagKey(u)] = etag
+}
+
+// has - any of urls has stored ETag
+func (e *torrentETags) has(urls []*url.URL) bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, u := range urls {
+		if _, ok := e.byUrl[etagKey(u)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// forget - .torrent file is not on disk: ETag must not be sent, otherwise 304 leaves us without file
+func (e *torrentETags) forget(urls []*url.URL) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, u := range urls {
+		delete(e.byUrl, etagKey(u))
+	}
+}
+
+// loadTorrentETags - missing or broken file - empty set
+func (d *WebSeeds) loadTorrentETags(rootDir string) *torrentETags {
+	e := &torrentETags{byUrl: map[string]string{}}
+	data, err := os.ReadFile(filepath.Join(rootDir, torrentETagsFileName))
+	if err != nil {
+		return e
+	}
+	if err := json.Unmarshal(data, &e.byUrl); err != nil || e.byUrl == nil {
+		d.logger.Debug("[snapshots] broken webseed etags file, ignoring it", "err", err)
+		e.byUrl = map[string]string{}
+	}
+	return e
+}
+
+func (d *WebSeeds) saveTorrentETags(rootDir string, e *torrentETags) {
+	e.lock.Lock()
+	data, err := json.Marshal(e.byUrl)
+	e.lock.Unlock()
+	if err != nil {
+		return
+	}
+	if err := saveTorrentFS(d.torrentFS, filepath.Join(rootDir, torrentETagsFileName), data); err != nil {
+		d.logger.Debug("[snapshots] save webseed etags", "err", err)
+	}
+}
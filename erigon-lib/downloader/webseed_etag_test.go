@@ -0,0 +1,60 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsTorrentsETag(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	torrent, etag := testTorrentBytes(t, "a.seg"), `"v1"`
+	var downloads, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads.Add(1)
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write(torrent)
+	}))
+	defer srv.Close()
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(fmt.Sprintf(`"a.seg.torrent" = "%s/a.seg.torrent?sig=1"`, srv.URL)), 0644))
+
+	discover := func() {
+		ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedTorrentsETag: true})
+		ws.downloadTorrentFile = true
+		ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+		ws.downloadTorrentFilesFromProviders(context.Background(), dir)
+	}
+	discover()
+	require.Equal(int32(1), downloads.Load())
+	discover() // same ETag - not re-downloaded
+	require.Equal(int32(1), downloads.Load())
+	require.Equal(int32(1), notModified.Load())
+
+	torrent, etag = testTorrentBytes(t, "a2.seg"), `"v2"` // changed on server
+	discover()
+	require.Equal(int32(2), downloads.Load())
+	onDisk, err := os.ReadFile(filepath.Join(dir, "a.seg.torrent"))
+	require.NoError(err)
+	require.Equal(torrent, onDisk)
+
+	// file removed by hand - must be downloaded without If-None-Match
+	require.NoError(os.Remove(filepath.Join(dir, "a.seg.torrent")))
+	discover()
+	require.Equal(int32(3), downloads.Load())
+	require.FileExists(filepath.Join(dir, "a.seg.torrent"))
+}
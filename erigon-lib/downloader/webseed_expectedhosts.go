@@ -0,0 +1,109 @@
+package downloader
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+)
+
+const expectedHostRegexpPrefix = "re:"
+
+// hostPatterns - hosts all urls of manifests expected to belong to (for example, own CDN domain).
+// Stricter than hostAllowlist: meant to catch manifest tampering, which redirects downloads to other hosts
+type hostPatterns struct {
+	patterns []string // as configured, for logs
+	globs    []string
+	regexps  []*regexp.Regexp
+}
+
+// parseHostPatterns - entries: glob `*.our-cdn.com`, `cdn-?.example.com` (see path.Match, `*` matches any subdomain depth)
+// or regexp with `re:` prefix `re:^cdn[0-9]+\.example\.com$` (matched against whole host). Empty list - nil (any host expected)
+func parseHostPatterns(entries []string) (*hostPatterns, error) {
+	res := &hostPatterns{}
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		switch {
+		case e == "":
+			continue
+		case strings.HasPrefix(e, expectedHostRegexpPrefix):
+			re, err := regexp.Compile("(?i)" + strings.TrimPrefix(e, expectedHostRegexpPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("invalid expected host %q: %w", e, err)
+			}
+			res.regexps = append(res.regexps, re)
+		default:
+			glob := strings.ToLower(e)
+			if _, err := path.Match(glob, ""); err != nil {
+				return nil, fmt.Errorf("invalid expected host %q: %w", e, err)
+			}
+			res.globs = append(res.globs, glob)
+		}
+		res.patterns = append(res.patterns, e)
+	}
+	if len(res.patterns) == 0 {
+		return nil, nil
+	}
+	return res, nil
+}
+
+// matches - host without port. nil patterns match any host
+func (p *hostPatterns) matches(host string) bool {
+	if p == nil {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, glob := range p.globs {
+		if ok, _ := path.Match(glob, host); ok {
+			return true
+		}
+	}
+	for _, re := range p.regexps {
+		if loc := re.FindStringIndex(host); loc != nil && loc[0] == 0 && loc[1] == len(host) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *hostPatterns) matchesUrl(rawUrl string) bool {
+	if p == nil {
+		return true
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return false
+	}
+	return p.matches(u.Hostname())
+}
+
+// SetExpectedHosts - replaces WebSeedExpectedHosts (see parseHostPatterns for syntax), empty - no check.
+// Takes effect on next Discover: run in progress completes with old patterns
+func (d *WebSeeds) SetExpectedHosts(patterns []string) error {
+	p, err := parseHostPatterns(patterns)
+	if err != nil {
+		return err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.expectedHosts = p
+	return nil
+}
+
+// unexpectedHost - url of manifest doesn't match expected hosts of this run: always warned, dropped unless ExpectedHostsWarn
+func (d *WebSeeds) unexpectedHost(m *mergedManifests, name, wUrl, provider string) (drop bool) {
+	if m.expectedHosts.matchesUrl(wUrl) {
+		return false
+	}
+	m.unexpectedHost++
+	drop = d.expectedHostsCheck != downloadercfg.ExpectedHostsWarn
+	d.logger.Warn("[snapshots] webseed url points to unexpected host (possible manifest tampering)",
+		"file", name, "url", redactRawUrl(wUrl), "provider", provider, "expected", m.expectedHosts.patterns, "dropped", drop)
+	if drop {
+		d.logSkip(name, SkipUnexpectedHost, "url", redactRawUrl(wUrl))
+	}
+	return drop
+}
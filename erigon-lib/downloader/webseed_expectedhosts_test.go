@@ -0,0 +1,63 @@
+package downloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsExpectedHosts(t *testing.T) {
+	require := require.New(t)
+	_, err := parseHostPatterns([]string{"re:(cdn"})
+	require.Error(err)
+	_, err = parseHostPatterns([]string{"[cdn"})
+	require.Error(err)
+
+	p, err := parseHostPatterns([]string{"*.our-cdn.com", `re:^edge[0-9]+\.mirror\.org$`})
+	require.NoError(err)
+	require.True(p.matches("eu.our-cdn.com"))
+	require.True(p.matches("EU.our-cdn.com."))
+	require.False(p.matches("our-cdn.com"))
+	require.True(p.matches("a.eu.our-cdn.com"))
+	require.False(p.matches("eu.our-cdn.com.evil.com"))
+	require.True(p.matches("edge12.mirror.org"))
+	require.False(p.matches("edge12.mirror.org.evil.com"))
+	require.False(p.matches("xedge12.mirror.org"))
+	require.True((*hostPatterns)(nil).matchesUrl("https://any.com/a.seg"))
+
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`
+"a.seg" = "https://eu.our-cdn.com/a.seg"
+"b.seg" = "https://rogue.com/b.seg"
+"b.seg.torrent" = "https://rogue.com/b.seg.torrent"
+"c.seg.torrent" = "https://us.our-cdn.com/c.seg.torrent"
+`), 0644))
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedExpectedHosts: []string{"*.our-cdn.com"}})
+	require.NoError(ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest}))
+	require.Equal(1, ws.Len())
+	require.Equal(1, len(ws.TorrentUrls()))
+	require.Contains(ws.TorrentUrls(), "c.seg.torrent")
+
+	// advisory: only warned
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedExpectedHosts: []string{"*.our-cdn.com"}, WebSeedExpectedHostsCheck: downloadercfg.ExpectedHostsWarn})
+	require.NoError(ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest}))
+	require.Equal(2, ws.Len())
+	require.Equal(2, len(ws.TorrentUrls()))
+
+	// per-run: replaced patterns used by next run
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{})
+	require.Error(ws.SetExpectedHosts([]string{"re:("}))
+	require.NoError(ws.SetExpectedHosts([]string{"rogue.com"}))
+	require.NoError(ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest}))
+	require.Equal(1, ws.Len())
+	require.Equal(1, len(ws.TorrentUrls()))
+	require.Contains(ws.TorrentUrls(), "b.seg.torrent")
+	require.Equal([]string{"rogue.com"}, ws.Config()["expected_hosts"])
+	require.NoError(ws.SetExpectedHosts(nil))
+	require.NoError(ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest}))
+	require.Equal(2, ws.Len())
+}
@@ -0,0 +1,31 @@
+package downloader
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"io/fs"
+)
+
+// fallbackManifests - `webseedfallback/<chainName>.toml`, see webseedfallback/README.md
+//
+//go:embed webseedfallback
+var fallbackManifests embed.FS
+
+// fallbackManifest - last-resort provider: file from config, or manifest embedded into binary. nil if not available.
+func (d *WebSeeds) fallbackManifest() (*webSeedManifest, error) {
+	if d.disableFallback {
+		return nil, nil
+	}
+	if d.fallbackFile != "" {
+		return d.readWebSeedsFile(d.fallbackFile)
+	}
+	data, err := fallbackManifests.ReadFile("webseedfallback/" + d.chainName + ".toml")
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return decodeWebSeedsManifest(bytes.NewReader(data))
+}
@@ -0,0 +1,52 @@
+package downloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsFallbackManifest(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	fallback := filepath.Join(dir, "fallback.toml")
+	require.NoError(os.WriteFile(fallback, []byte(`"a.seg" = "https://a.com/a.seg"`), 0644))
+	manifest := filepath.Join(dir, "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`"b.seg" = "https://a.com/b.seg"`), 0644))
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedFallbackFile: fallback})
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, nil)
+	_, ok := ws.ByFileName("a.seg")
+	require.True(ok)
+
+	// used only if other providers returned nothing
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+	_, ok = ws.ByFileName("a.seg")
+	require.False(ok)
+
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedFallbackFile: fallback, WebSeedDisableFallback: true})
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, nil)
+	require.Equal(0, ws.Len())
+
+	// embedded into binary: magnet links of preverified snapshots
+	for _, chain := range []string{"mainnet", "sepolia", "goerli", "gnosis", "chiado", "mumbai", "bor-mainnet"} {
+		ws = newTestWebSeeds(t, &downloadercfg.Cfg{ChainName: chain})
+		m, err := ws.fallbackManifest()
+		require.NoError(err)
+		require.NotEmpty(m.files, chain)
+		require.Equal(chain, m.chain)
+	}
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{ChainName: "mainnet"})
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, nil)
+	magnet, ok := ws.MagnetFor("v1-000000-000500-bodies.seg")
+	require.True(ok)
+	require.Equal("e9b5c5d1885ee3c6ab6005919e511e1e04c7e34e", magnet.InfoHash.HexString())
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{ChainName: "mainnet", WebSeedDisableFallback: true})
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, nil)
+	_, ok = ws.MagnetFor("v1-000000-000500-bodies.seg")
+	require.False(ok)
+}
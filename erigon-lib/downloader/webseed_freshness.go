@@ -0,0 +1,91 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+)
+
+// ErrStaleManifest - manifest generated before time of provider's latest marker: mirror serves cached old manifest
+var ErrStaleManifest = errors.New("stale manifest")
+
+// latestMarkerName - by convention marker is next to manifest
+const latestMarkerName = "latest.txt"
+
+const maxLatestMarkerSize = 1024
+
+// latestMarkerUrl - configured for provider, or `latest.txt` in directory of manifest
+func (d *WebSeeds) latestMarkerUrl(providerUrl *url.URL) (*url.URL, error) {
+	if marker, ok := d.latestMarkers[providerUrl.String()]; ok {
+		return url.Parse(marker)
+	}
+	return providerUrl.Parse(latestMarkerName)
+}
+
+// fetchLatestMarker - zero time if provider has no marker. Marker is RFC3339 time or unix seconds
+func (d *WebSeeds) fetchLatestMarker(ctx context.Context, providerUrl *url.URL) (time.Time, error) {
+	u, err := d.latestMarkerUrl(providerUrl)
+	if err != nil {
+		return time.Time{}, err
+	}
+	request, err := d.newRequest(ctx, http.MethodGet, u)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp, err := d.do(request)
+	if err != nil {
+		return time.Time{}, classifyNetworkErr(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return time.Time{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("latest marker: unexpected http status: %s", resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(checkTruncation(resp), maxLatestMarkerSize))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parseLatestMarker(string(b))
+}
+
+func parseLatestMarker(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if unix, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("latest marker: expecting RFC3339 time or unix seconds: %w", err)
+	}
+	return t, nil
+}
+
+// checkFreshness - `latest` fetched before manifest, so manifest generated after marker was published is fresh
+func (d *WebSeeds) checkFreshness(providerUrl *url.URL, latest time.Time, m *webSeedManifest) error {
+	if latest.IsZero() {
+		return nil
+	}
+	if m.generatedAt.IsZero() {
+		d.logger.Debug("[snapshots] webseed manifest has no generated_at, freshness not checked", "provider", redactUrl(providerUrl))
+		return nil
+	}
+	if !m.generatedAt.Before(latest) {
+		return nil
+	}
+	if d.freshnessCheck == downloadercfg.FreshnessCheckReject {
+		return newProviderErr(ProviderErrOther, fmt.Errorf("%w: generated at %s, latest is %s", ErrStaleManifest, m.generatedAt.Format(time.RFC3339), latest.Format(time.RFC3339)))
+	}
+	d.logger.Warn("[snapshots] webseed provider serves stale manifest", "provider", redactUrl(providerUrl),
+		"generated_at", m.generatedAt.Format(time.RFC3339), "latest", latest.Format(time.RFC3339))
+	return nil
+}
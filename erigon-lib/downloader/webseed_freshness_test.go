@@ -0,0 +1,58 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsFreshness(t *testing.T) {
+	require := require.New(t)
+	generatedAt := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stale/latest.txt":
+			_, _ = fmt.Fprint(w, generatedAt.Add(time.Hour).Format(time.RFC3339))
+		case "/fresh/latest.txt":
+			_, _ = fmt.Fprintf(w, "%d\n", generatedAt.Add(-time.Hour).Unix())
+		case "/nomarker/latest.txt", "/custom/latest.txt":
+			w.WriteHeader(http.StatusNotFound)
+		case "/marker-for-custom":
+			_, _ = fmt.Fprint(w, generatedAt.Add(time.Hour).Format(time.RFC3339))
+		default:
+			_, _ = fmt.Fprintf(w, "generated_at = %s\n\"a.seg\" = \"https://a.com/a.seg\"", generatedAt.Format(time.RFC3339))
+		}
+	}))
+	defer srv.Close()
+
+	for _, c := range []struct {
+		path   string
+		check  downloadercfg.FreshnessCheck
+		reject bool
+	}{
+		{path: "/stale/webseeds.toml", check: downloadercfg.FreshnessCheckDisabled},
+		{path: "/stale/webseeds.toml", check: downloadercfg.FreshnessCheckWarn},
+		{path: "/stale/webseeds.toml", check: downloadercfg.FreshnessCheckReject, reject: true},
+		{path: "/fresh/webseeds.toml", check: downloadercfg.FreshnessCheckReject},
+		{path: "/nomarker/webseeds.toml", check: downloadercfg.FreshnessCheckReject},
+		{path: "/custom/webseeds.toml", check: downloadercfg.FreshnessCheckReject, reject: true},
+	} {
+		ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedFreshnessCheck: c.check,
+			WebSeedLatestMarkers: map[string]string{srv.URL + "/custom/webseeds.toml": srv.URL + "/marker-for-custom"}})
+		u, err := url.Parse(srv.URL + c.path)
+		require.NoError(err)
+		_, err = ws.callHttpProvider(context.Background(), u)
+		if c.reject {
+			require.ErrorIs(err, ErrStaleManifest, c.path)
+			continue
+		}
+		require.NoError(err, c.path)
+	}
+}
@@ -0,0 +1,135 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// Git providers: `git+https://host/org/repo.git?ref=v1.2&path=mainnet/webseeds.toml` (also git+http, git+ssh, git+file).
+// `ref` - commit, tag or branch, default HEAD of remote. Full commit hash pins manifest: fetched commit is verified.
+// `path` - of manifest in repo, default webseeds.toml.
+// Auth: git+ssh - by WebSeedSSHKeyFile (host verified by WebSeedSSHKnownHosts), git+https - by WebSeedGitToken (never sent over git+http).
+// Requires `git` binary. Shallow fetch of 1 commit into temp dir, removed after: nothing is kept between runs
+const (
+	gitProviderSchemePrefix = "git+"
+	gitQueryRef             = "ref"
+	gitQueryPath            = "path"
+	defaultGitManifestPath  = "webseeds.toml"
+)
+
+var gitCommitHash = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+func isGitProvider(u *url.URL) bool { return strings.HasPrefix(u.Scheme, gitProviderSchemePrefix) }
+
+// gitRemote - url for git (without `git+` and our query params), ref, path of manifest
+func gitRemote(u *url.URL) (remote, ref, path string, err error) {
+	r := *u
+	r.Scheme = strings.TrimPrefix(u.Scheme, gitProviderSchemePrefix)
+	switch r.Scheme {
+	case "https", "http", "ssh", "file":
+	default:
+		return "", "", "", fmt.Errorf("git webseed provider: not supported scheme %q", u.Scheme)
+	}
+	q := r.Query()
+	ref, path = q.Get(gitQueryRef), q.Get(gitQueryPath)
+	q.Del(gitQueryRef)
+	q.Del(gitQueryPath)
+	r.RawQuery = q.Encode()
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if path == "" {
+		path = defaultGitManifestPath
+	}
+	if strings.HasPrefix(ref, "-") || strings.HasPrefix(path, "-") { // not options of git
+		return "", "", "", fmt.Errorf("git webseed provider: invalid ref or path")
+	}
+	return r.String(), ref, path, nil
+}
+
+func (d *WebSeeds) callGitProvider(ctx context.Context, u *url.URL) (*webSeedManifest, error) {
+	remote, ref, path, err := gitRemote(u)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "webseed-git-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if _, err := d.git(ctx, dir, nil, "init", "-q"); err != nil {
+		return nil, err
+	}
+	if _, err := d.git(ctx, dir, d.gitAuthEnv(remote), "fetch", "-q", "--depth=1", "--no-tags", "--", remote, ref); err != nil {
+		return nil, newProviderErr(ProviderErrConnect, err)
+	}
+	if gitCommitHash.MatchString(ref) {
+		fetched, err := d.git(ctx, dir, nil, "rev-parse", "FETCH_HEAD")
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(string(fetched)) != ref {
+			return nil, newProviderErr(ProviderErrOther, fmt.Errorf("git webseed provider: fetched commit %s, pinned %s", bytes.TrimSpace(fetched), ref))
+		}
+	}
+	data, err := d.git(ctx, dir, nil, "show", "FETCH_HEAD:"+path)
+	if err != nil {
+		return nil, newProviderErr(ProviderErrOther, err)
+	}
+	response, err := decodeWebSeedsManifest(bytes.NewReader(data))
+	if err != nil {
+		return nil, newProviderErr(ProviderErrParse, err)
+	}
+	return response, nil
+}
+
+// gitAuthEnv - credentials for fetch from `remote`. Token only for https remote, and scoped to it by `http.<url>.*` config:
+// never sent in cleartext or to other hosts. Redirects of that remote are not followed - would carry token too
+func (d *WebSeeds) gitAuthEnv(remote string) []string {
+	var env []string
+	if d.sshKeyFile != "" {
+		sshCmd := "ssh -o BatchMode=yes -o IdentitiesOnly=yes -o StrictHostKeyChecking=yes -i " + shellQuote(d.sshKeyFile)
+		if d.sshKnownHosts != "" {
+			sshCmd += " -o UserKnownHostsFile=" + shellQuote(d.sshKnownHosts)
+		}
+		env = append(env, "GIT_SSH_COMMAND="+sshCmd)
+	}
+	if d.gitToken != "" && strings.HasPrefix(remote, "https://") {
+		env = append(env, "GIT_CONFIG_COUNT=2",
+			"GIT_CONFIG_KEY_0=http."+remote+".extraHeader", "GIT_CONFIG_VALUE_0=Authorization: Bearer "+d.gitToken,
+			"GIT_CONFIG_KEY_1=http."+remote+".followRedirects", "GIT_CONFIG_VALUE_1=false")
+	}
+	return env
+}
+
+// git - runs git in `dir`, returns stdout. Never prompts for credentials. Secrets passed by env, not by args (visible to other users)
+func (d *WebSeeds) git(ctx context.Context, dir string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0"), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("git webseed provider: git binary not found: %w", err)
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// shellQuote - GIT_SSH_COMMAND is interpreted by shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,90 @@
+package downloader
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsGitProvider(t *testing.T) {
+	require := require.New(t)
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("no git binary")
+	}
+	repo := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false", "-c", "tag.gpgsign=false"}, args...)...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		require.NoError(err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	commit := func(path, content string) string {
+		require.NoError(os.MkdirAll(filepath.Dir(filepath.Join(repo, path)), 0755))
+		require.NoError(os.WriteFile(filepath.Join(repo, path), []byte(content), 0644))
+		git("add", "-A")
+		git("commit", "-q", "-m", path)
+		return git("rev-parse", "HEAD")
+	}
+	git("init", "-q")
+	first := commit("webseeds.toml", `"a.seg" = "https://example.com/a.seg"`)
+	git("tag", "v1")
+	commit("webseeds.toml", `"b.seg" = "https://example.com/b.seg"`)
+	commit("goerli/webseeds.toml", `"c.seg" = "https://example.com/c.seg"`)
+
+	names := func(query string) ([]string, error) {
+		u, err := url.Parse("git+file://" + filepath.ToSlash(repo) + query)
+		require.NoError(err)
+		ws := newTestWebSeeds(t, nil)
+		m, err := ws.callUrlProvider(context.Background(), u)
+		if err != nil {
+			return nil, err
+		}
+		var res []string
+		for name := range m.files {
+			res = append(res, name)
+		}
+		return res, nil
+	}
+	for query, expected := range map[string]string{
+		"":                           "b.seg",
+		"?ref=v1":                    "a.seg",
+		"?ref=" + first:              "a.seg",
+		"?path=goerli/webseeds.toml": "c.seg",
+	} {
+		res, err := names(query)
+		require.NoError(err, query)
+		require.Equal([]string{expected}, res, query)
+	}
+	_, err := names("?path=missing.toml")
+	require.Error(err)
+	_, err = names("?ref=no-such-tag")
+	require.Error(err)
+	_, err = names("?ref=--upload-pack=touch")
+	require.ErrorContains(err, "invalid ref")
+
+	_, _, _, err = gitRemote(&url.URL{Scheme: "git+ftp", Host: "example.com"})
+	require.Error(err)
+	remote, ref, path, err := gitRemote(&url.URL{Scheme: "git+https", Host: "example.com", Path: "/org/repo.git", RawQuery: "ref=v2&path=x.toml"})
+	require.NoError(err)
+	require.Equal([]string{"https://example.com/org/repo.git", "v2", "x.toml"}, []string{remote, ref, path})
+
+	// token: only for https remote, scoped to it
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedGitToken: "secret"})
+	require.Equal([]string{"GIT_CONFIG_COUNT=2",
+		"GIT_CONFIG_KEY_0=http.https://example.com/org/repo.git.extraHeader", "GIT_CONFIG_VALUE_0=Authorization: Bearer secret",
+		"GIT_CONFIG_KEY_1=http.https://example.com/org/repo.git.followRedirects", "GIT_CONFIG_VALUE_1=false"}, ws.gitAuthEnv(remote))
+	for _, remote := range []string{"http://example.com/org/repo.git", "file:///repo", "ssh://git@example.com/org/repo.git"} {
+		require.Empty(ws.gitAuthEnv(remote), remote)
+	}
+	require.True(secureUrl(&url.URL{Scheme: "git+https"}))
+	require.False(secureUrl(&url.URL{Scheme: "git+http"}))
+	require.False(secureUrl(&url.URL{Scheme: "git+file"}))
+}
@@ -0,0 +1,93 @@
+package downloader
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// http3HandshakeTimeout - UDP may be blocked on the way to provider: don't wait long before fallback
+const http3HandshakeTimeout = 3 * time.Second
+
+// http3FallbackTransport - tries HTTP/3 (QUIC) for https urls, on failure falls back to `fallback` (HTTP/2 or HTTP/1.1)
+// and doesn't try HTTP/3 for that host anymore. Our requests have no body, so retry is safe.
+// QUIC dialer knows nothing about settings of `fallback`: hosts with overridden TLS server name or IP, and requests
+// going through proxy (of environment: HTTPS_PROXY) always use `fallback`
+type http3FallbackTransport struct {
+	h3       *http3.RoundTripper
+	fallback http.RoundTripper
+	proxy    func(*http.Request) (*url.URL, error) // of `fallback`, nil - no proxy
+
+	lock sync.Mutex
+	noH3 map[string]struct{} // lowercase hosts where HTTP/3 failed, or with overridden TLS server name or IP
+}
+
+func newHttp3FallbackTransport(tlsConfig *tls.Config, fallback http.RoundTripper, proxy func(*http.Request) (*url.URL, error), hostOverrides, resolveOverrides map[string]string) *http3FallbackTransport {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	} else {
+		tlsConfig = tlsConfig.Clone()
+	}
+	noH3 := make(map[string]struct{}, len(hostOverrides)+len(resolveOverrides))
+	for host := range hostOverrides { // http3.RoundTripper takes TLS server name from url
+		noH3[strings.ToLower(host)] = struct{}{}
+	}
+	for host := range resolveOverrides { // and resolves host by system DNS
+		noH3[strings.ToLower(host)] = struct{}{}
+	}
+	return &http3FallbackTransport{
+		h3: &http3.RoundTripper{
+			TLSClientConfig: tlsConfig,
+			QuicConfig:      &quic.Config{HandshakeIdleTimeout: http3HandshakeTimeout},
+		},
+		fallback: fallback,
+		proxy:    proxy,
+		noH3:     noH3,
+	}
+}
+
+func (t *http3FallbackTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" || req.Body != nil && req.Body != http.NoBody {
+		return t.fallback.RoundTrip(req)
+	}
+	host := strings.ToLower(req.URL.Hostname())
+	t.lock.Lock()
+	_, noH3 := t.noH3[host]
+	t.lock.Unlock()
+	if noH3 || t.proxied(req) {
+		return t.fallback.RoundTrip(req)
+	}
+	resp, err := t.h3.RoundTrip(req)
+	if err == nil {
+		return resp, nil
+	}
+	if req.Context().Err() != nil {
+		return nil, err
+	}
+	t.lock.Lock()
+	t.noH3[host] = struct{}{}
+	t.lock.Unlock()
+	return t.fallback.RoundTrip(req)
+}
+
+func (t *http3FallbackTransport) CloseIdleConnections() {
+	t.h3.CloseIdleConnections()
+	if c, ok := t.fallback.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// proxied - request would go through proxy by `fallback`: QUIC can't, and direct connection may be not allowed (or not possible)
+func (t *http3FallbackTransport) proxied(req *http.Request) bool {
+	if t.proxy == nil {
+		return false
+	}
+	proxyUrl, err := t.proxy(req)
+	return err != nil || proxyUrl != nil
+}
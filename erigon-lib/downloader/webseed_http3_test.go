@@ -0,0 +1,102 @@
+package downloader
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsHTTP3(t *testing.T) {
+	require := require.New(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `"a.seg" = "https://a.com/a.seg?proto=%s"`, url.QueryEscape(r.Proto))
+	})
+	srv := httptest.NewTLSServer(handler) // tcp only
+	defer srv.Close()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(err)
+	h3srv := &http3.Server{Handler: handler, TLSConfig: &tls.Config{Certificates: srv.TLS.Certificates}}
+	go func() { _ = h3srv.Serve(udp) }()
+	defer h3srv.Close()
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedHTTP3: true})
+	ws.httpClient.Transport.(*http3FallbackTransport).h3.QuicConfig.HandshakeIdleTimeout = 300 * time.Millisecond
+	trustTestServer(ws, srv)
+	proto := func(rawUrl string) string {
+		u, err := url.Parse(rawUrl)
+		require.NoError(err)
+		m, err := ws.callHttpProvider(context.Background(), u)
+		require.NoError(err)
+		seedUrl, err := url.Parse(m.files["a.seg"])
+		require.NoError(err)
+		return seedUrl.Query().Get("proto")
+	}
+	require.Equal("HTTP/3.0", proto("https://"+udp.LocalAddr().String()+"/webseeds.toml"))
+	require.Equal("HTTP/1.1", proto(srv.URL+"/webseeds.toml")) // no QUIC listener - fallback
+	require.Contains(ws.httpClient.Transport.(*http3FallbackTransport).noH3, "127.0.0.1")
+}
+
+func TestWebSeedsHTTP3Bypass(t *testing.T) {
+	require := require.New(t)
+	var dials, fallbacks atomic.Int32
+	newTransport := func(proxy func(*http.Request) (*url.URL, error), resolveOverrides map[string]string) *http3FallbackTransport {
+		fallback := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			fallbacks.Add(1)
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: r}, nil
+		})
+		tr := newHttp3FallbackTransport(nil, fallback, proxy, nil, resolveOverrides)
+		tr.h3.Dial = func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+			dials.Add(1)
+			return nil, errors.New("no quic")
+		}
+		return tr
+	}
+	get := func(tr *http3FallbackTransport, rawUrl string) (h3Dials, fallbackCalls int32) {
+		dials.Store(0)
+		fallbacks.Store(0)
+		req, err := http.NewRequest(http.MethodGet, rawUrl, nil)
+		require.NoError(err)
+		resp, err := tr.RoundTrip(req)
+		require.NoError(err)
+		resp.Body.Close()
+		return dials.Load(), fallbacks.Load()
+	}
+
+	// host with resolve override: QUIC would resolve it by system DNS
+	tr := newTransport(nil, map[string]string{"Mirror.example.com": "127.0.0.1"})
+	h3Dials, fallbackCalls := get(tr, "https://mirror.example.com/webseeds.toml")
+	require.Equal([2]int32{0, 1}, [2]int32{h3Dials, fallbackCalls})
+	h3Dials, fallbackCalls = get(tr, "https://other.example.com/webseeds.toml")
+	require.Equal([2]int32{1, 1}, [2]int32{h3Dials, fallbackCalls})
+
+	// proxy of environment applies: QUIC can't go through it
+	tr = newTransport(func(r *http.Request) (*url.URL, error) {
+		if r.URL.Hostname() == "proxied.example.com" {
+			return url.Parse("http://proxy.example.com:3128")
+		}
+		return nil, nil
+	}, nil)
+	h3Dials, fallbackCalls = get(tr, "https://proxied.example.com/webseeds.toml")
+	require.Equal([2]int32{0, 1}, [2]int32{h3Dials, fallbackCalls})
+	h3Dials, fallbackCalls = get(tr, "https://direct.example.com/webseeds.toml")
+	require.Equal([2]int32{1, 1}, [2]int32{h3Dials, fallbackCalls})
+
+	// wired by config
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedHTTP3: true, WebSeedResolveOverrides: map[string]string{"mirror.example.com": "127.0.0.1"}})
+	h3 := ws.httpClient.Transport.(*http3FallbackTransport)
+	require.Contains(h3.noH3, "mirror.example.com")
+	require.NotNil(h3.proxy)
+}
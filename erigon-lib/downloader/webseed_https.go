@@ -0,0 +1,56 @@
+package downloader
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+)
+
+// secureUrl - url is encrypted in transit. sftp, git+* - only for providers
+func secureUrl(u *url.URL) bool {
+	switch u.Scheme {
+	case "https", "sftp", "git+https", "git+ssh":
+		return true
+	default:
+		return false
+	}
+}
+
+func secureRawUrl(rawUrl string) bool {
+	u, err := url.Parse(rawUrl)
+	return err == nil && u.Scheme == "https"
+}
+
+// checkS3EndpointHTTPS - config error: caught at start
+func checkS3EndpointHTTPS(requireHTTPS bool, e *downloadercfg.S3Endpoint) error {
+	if requireHTTPS && e != nil && !strings.HasPrefix(e.Endpoint, "https://") {
+		return fmt.Errorf("webseed s3 endpoint %q is not https, while https is required", e.Endpoint)
+	}
+	return nil
+}
+
+// secureProviders - with `requireHTTPS` drops providers reachable by plain http
+func (d *WebSeeds) secureProviders(s3Providers []string, httpProviders []*url.URL) ([]string, []*url.URL) {
+	if !d.requireHTTPS {
+		return s3Providers, httpProviders
+	}
+	var secureS3 []string
+	for _, token := range s3Providers {
+		if t, err := parseS3Token(token); err == nil && strings.HasPrefix(t.endpoint, "http://") {
+			d.logger.Warn("[snapshots] https required, dropped s3 webseed provider with http endpoint", "provider", d.s3ProviderName(token))
+			continue
+		}
+		secureS3 = append(secureS3, token)
+	}
+	var secureHttp []*url.URL
+	for _, u := range httpProviders {
+		if !secureUrl(u) {
+			d.logger.Warn("[snapshots] https required, dropped webseed provider", "url", redactUrl(u))
+			continue
+		}
+		secureHttp = append(secureHttp, u)
+	}
+	return secureS3, secureHttp
+}
@@ -0,0 +1,97 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsRequireHTTPS(t *testing.T) {
+	require := require.New(t)
+	var called atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+		_, _ = w.Write([]byte(`"c.seg" = "https://a.com/c.seg"`))
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL + "/webseeds.toml")
+	require.NoError(err)
+	dir := t.TempDir()
+	secure, insecure := filepath.Join(dir, "secure.toml"), filepath.Join(dir, "insecure.toml")
+	require.NoError(os.WriteFile(secure, []byte(`"a.seg" = "https://a.com/a.seg"`), 0644))
+	require.NoError(os.WriteFile(insecure, []byte(`
+"a.seg" = "http://a.com/a.seg"
+"b.seg" = "http://a.com/b.seg"
+"b.seg.torrent" = "http://a.com/b.seg.torrent"
+`), 0644))
+	manifests := []string{secure, insecure}
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedRequireHTTPS: true})
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, []*url.URL{u}, manifests)
+	require.False(called.Load())
+	urls, _ := ws.ByFileName("a.seg")
+	require.Equal([]string{"https://a.com/a.seg"}, []string(urls))
+	_, ok := ws.ByFileName("b.seg")
+	require.False(ok)
+	require.Equal(0, len(ws.TorrentUrls()))
+
+	ws = newTestWebSeeds(t, nil) // off by default
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, []*url.URL{u}, manifests)
+	require.True(called.Load())
+	require.Equal(3, ws.Len())
+
+	_, err = NewWebSeeds(&downloadercfg.Cfg{ChainName: "mainnet", WebSeedRequireHTTPS: true,
+		WebSeedS3Endpoints: map[string]downloadercfg.S3Endpoint{"mainnet": {Endpoint: "http://s3.invalid"}}}, log.New(), log.LvlInfo)
+	require.ErrorContains(err, "not https")
+}
+
+func TestWebSeedsRedirectRequireHTTPS(t *testing.T) {
+	require := require.New(t)
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `"a.seg" = "https://a.com/a.seg"`)
+	}))
+	defer plain.Close()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/secure.toml" {
+			fmt.Fprint(w, `"a.seg" = "https://a.com/a.seg"`)
+			return
+		}
+		to := plain.URL + "/webseeds.toml"
+		if r.URL.Path == "/to-https.toml" {
+			to = "/secure.toml"
+		}
+		http.Redirect(w, r, to, http.StatusFound)
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedRequireHTTPS: true})
+	trustTestServer(ws, srv)
+	u, err := url.Parse(srv.URL + "/to-http.toml")
+	require.NoError(err)
+	_, err = ws.callHttpProvider(ctx, u)
+	require.ErrorContains(err, "redirect to http url, while https is required")
+
+	u, err = url.Parse(srv.URL + "/to-https.toml")
+	require.NoError(err)
+	res, err := ws.callHttpProvider(ctx, u)
+	require.NoError(err)
+	require.Len(res.files, 1)
+
+	ws = newTestWebSeeds(t, nil) // off by default
+	trustTestServer(ws, srv)
+	u, err = url.Parse(srv.URL + "/to-http.toml")
+	require.NoError(err)
+	_, err = ws.callHttpProvider(ctx, u)
+	require.NoError(err)
+}
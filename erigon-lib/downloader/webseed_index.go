@@ -0,0 +1,68 @@
+package downloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ledgerwatch/erigon-lib/downloader/snaptype"
+)
+
+// torrentsIndexFileName - in rootDir. Doesn't match snapshot files naming, so ignored by snaptype.ParseDir
+const torrentsIndexFileName = ".webseed-torrents.json"
+
+// torrentsIndex - .torrent files confirmed present on disk by previous run, for same set of advertised names.
+// Allows restart skip stat of tens of thousands files. Files removed from disk by hand are not noticed until manifest changes.
+type torrentsIndex struct {
+	Manifest string          `json:"manifest"` // fingerprint of advertised .torrent names and their info-hashes
+	Present  map[string]bool `json:"present"`
+}
+
+func torrentsFingerprint(urls snaptype.TorrentUrls, infoHashes map[string]metainfo.Hash) string {
+	names := make([]string, 0, len(urls))
+	for name := range urls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		if hash, ok := infoHashes[strings.TrimSuffix(name, ".torrent")]; ok {
+			h.Write(hash[:])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// loadTorrentsIndex - present files of index, if it was built for same manifest. Missing or broken index - nil
+func (d *WebSeeds) loadTorrentsIndex(rootDir, fingerprint string) map[string]bool {
+	data, err := os.ReadFile(filepath.Join(rootDir, torrentsIndexFileName))
+	if err != nil {
+		return nil
+	}
+	var idx torrentsIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		d.logger.Debug("[snapshots] broken webseed torrents index, ignoring it", "err", err)
+		return nil
+	}
+	if idx.Manifest != fingerprint { // manifest changed
+		return nil
+	}
+	return idx.Present
+}
+
+func (d *WebSeeds) saveTorrentsIndex(rootDir, fingerprint string, present map[string]bool) {
+	data, err := json.Marshal(torrentsIndex{Manifest: fingerprint, Present: present})
+	if err != nil {
+		return
+	}
+	if err := saveTorrentFS(d.torrentFS, filepath.Join(rootDir, torrentsIndexFileName), data); err != nil {
+		d.logger.Debug("[snapshots] save webseed torrents index", "err", err)
+	}
+}
@@ -0,0 +1,30 @@
+package downloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/ledgerwatch/erigon-lib/downloader/snaptype"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsTorrentsIndex(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	require.NoError(os.WriteFile(filepath.Join(dir, "a.seg.torrent"), testTorrentBytes(t, "a.seg"), 0644))
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`"a.seg.torrent" = "https://a.com/a.seg.torrent"`), 0644))
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedTorrentsIndex: true})
+	ws.downloadTorrentFile = true
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+	ws.downloadTorrentFilesFromProviders(context.Background(), dir)
+	fingerprint := torrentsFingerprint(ws.TorrentUrls(), nil)
+	require.Equal(map[string]bool{"a.seg.torrent": true}, ws.loadTorrentsIndex(dir, fingerprint))
+
+	// manifest changed - index invalidated
+	require.Nil(ws.loadTorrentsIndex(dir, torrentsFingerprint(snaptype.TorrentUrls{"b.seg.torrent": nil}, nil)))
+}
@@ -0,0 +1,26 @@
+package downloader
+
+import (
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// isMagnet - manifest entry may be magnet link instead of url: `"v1-000000-000500-headers.seg" = "magnet:?xt=urn:btih:..."`,
+// for producers which can't host .torrent files. Such entries are not downloaded by http, see WebSeeds.MagnetFor
+func isMagnet(entry string) bool {
+	return strings.HasPrefix(entry, "magnet:")
+}
+
+// magnetKey - entry may be named by data file or by its .torrent file
+func magnetKey(name string) string {
+	return strings.TrimSuffix(name, ".torrent")
+}
+
+// MagnetFor - magnet link of file `name` (data file or its .torrent) from last Discover. If many providers have it - of first one
+func (d *WebSeeds) MagnetFor(name string) (metainfo.Magnet, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	m, ok := d.magnets[magnetKey(name)]
+	return m, ok
+}
@@ -0,0 +1,44 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsMagnets(t *testing.T) {
+	require := require.New(t)
+	hash := "0123456789abcdef0123456789abcdef01234567"
+	dir := t.TempDir()
+	primary, backup := filepath.Join(dir, "primary.toml"), filepath.Join(dir, "backup.toml")
+	require.NoError(os.WriteFile(primary, []byte(fmt.Sprintf(`
+"a.seg" = "magnet:?xt=urn:btih:%s&dn=a.seg&tr=udp://tracker.invalid:80"
+"b.seg.torrent" = "magnet:?xt=urn:btih:%s"
+"c.seg" = "magnet:?xt=urn:sha1:%s"
+"d.seg" = "https://a.com/d.seg"
+`, hash, hash, hash)), 0644))
+	require.NoError(os.WriteFile(backup, []byte(`"a.seg" = "magnet:?xt=urn:btih:ffffffffffffffffffffffffffffffffffffffff"`), 0644))
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedAllowedHosts: []string{"a.com"}, WebSeedRequireHTTPS: true})
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{primary, backup})
+	m, ok := ws.MagnetFor("a.seg")
+	require.True(ok)
+	require.Equal(hash, m.InfoHash.HexString()) // of first provider
+	require.Equal("a.seg", m.DisplayName)
+	require.Equal([]string{"udp://tracker.invalid:80"}, m.Trackers)
+	_, ok = ws.MagnetFor("b.seg.torrent")
+	require.True(ok)
+	_, ok = ws.MagnetFor("b.seg")
+	require.True(ok)
+	_, ok = ws.MagnetFor("c.seg") // not btih
+	require.False(ok)
+	_, ok = ws.MagnetFor("d.seg")
+	require.False(ok)
+	require.Equal(1, ws.Len())              // magnets are not http urls
+	require.Equal(0, len(ws.TorrentUrls())) // and are not downloaded
+}
@@ -0,0 +1,386 @@
+package downloader
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/downloader/snaptype"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Reserved keys of webseeds.toml. File names always have extension, so keys without "." can't collide with them.
+const (
+	manifestKeyRateLimit   = "rate_limit"   // provider asks clients to not download faster than this, for example: "10mb" (bytes per second)
+	manifestKeyGeneratedAt = "generated_at" // datetime, with `ttl` - when urls of manifest expire (signed urls)
+	manifestKeyTTL         = "ttl"          // duration, for example: "24h"
+	manifestKeySchema      = "schema_version"
+	manifestKeyChain       = "chain"   // name of chain manifest is for, for example: "mainnet"
+	manifestKeyNext        = "next"    // url (or object key for s3) of next page of manifest. Only for http and s3 providers
+	manifestKeyEntries     = "entries" // expected amount of entries (of all pages), to detect truncated manifest
+)
+
+// maxManifestPages - protect against endless chain of `next`
+const maxManifestPages = 1_000
+
+// Defaults of WebSeedMaxManifestEntries, WebSeedMaxTotalEntries: far above catalogs of known chains
+const (
+	defaultMaxManifestEntries = 10_000_000
+	defaultMaxTotalEntries    = 50_000_000
+)
+
+// limitOrDefault - 0 - default, <0 - no limit (0)
+func limitOrDefault(limit, defaultLimit int) int {
+	switch {
+	case limit == 0:
+		return defaultLimit
+	case limit < 0:
+		return 0
+	default:
+		return limit
+	}
+}
+
+// webSeedsSchemaVersion - latest version of webseeds.toml this node understands. Manifest without `schema_version` is v1.
+const webSeedsSchemaVersion = 1
+
+// Entry of manifest may be inline table instead of url:
+//
+//	"v1-000000-000500-headers.seg" = { url = "https://...", expires = 2023-10-01T00:00:00Z }
+const (
+	entryKeyUrl      = "url"
+	entryKeyExpires  = "expires"   // datetime, overrides manifest-level `generated_at + ttl`
+	entryKeyInfoHash = "info_hash" // hex, expected info-hash of .torrent of this file
+	entryKeySize     = "size"      // bytes or "10mb", size of this file
+	entryKeyToBlock  = "to_block"  // end (exclusive) of block range of data file, for files which name has no block range
+	entryKeyPriority = "priority"  // integer, higher - download earlier, see WebSeeds.PriorityFor
+	entryKeyChecksum = "checksum"  // `<algo>:<hex>` or `<hex>` (sha256) of data file, same format as sidecar, see parseChecksum
+)
+
+// webSeedManifest - parsed webseeds.toml: `"fileName" = "url"` entries + optional provider-level hints
+type webSeedManifest struct {
+	files     snaptype.WebSeedsFromProvider
+	meta      map[string]*webSeedFileMeta // only for entries defined as inline table
+	rateLimit datasize.ByteSize           // per second, 0 - no hint
+
+	generatedAt   time.Time
+	ttl           time.Duration
+	schemaVersion int64
+	next          string // of this page, after followManifestPages - empty
+	chain         string // empty - not declared
+	entries       int64  // declared amount of entries, 0 - not declared
+	provider      string // redacted url, s3 bucket/key or file path: for stats and logs
+}
+
+// mergePage - entries of next page are added to first page, other fields of next pages ignored
+func (m *webSeedManifest) mergePage(page *webSeedManifest) {
+	for name, url := range page.files {
+		m.files[name] = url
+	}
+	for name, meta := range page.meta {
+		if m.meta == nil {
+			m.meta = map[string]*webSeedFileMeta{}
+		}
+		m.meta[name] = meta
+	}
+	m.next = page.next
+}
+
+// followManifestPages - fetches pages while they have `next`, merges them into first page
+func followManifestPages(first *webSeedManifest, fetchNext func(next string) (*webSeedManifest, error)) (*webSeedManifest, error) {
+	seen := map[string]struct{}{}
+	for pages := 1; first.next != ""; pages++ {
+		if _, ok := seen[first.next]; ok {
+			return nil, newProviderErr(ProviderErrParse, fmt.Errorf("manifest pages have cycle: %s", first.next))
+		}
+		if pages >= maxManifestPages {
+			return nil, newProviderErr(ProviderErrParse, fmt.Errorf("manifest has more than %d pages", maxManifestPages))
+		}
+		seen[first.next] = struct{}{}
+		page, err := fetchNext(first.next)
+		if err != nil {
+			return nil, err
+		}
+		first.mergePage(page)
+	}
+	return first, nil
+}
+
+// webSeedFileMeta - optional metadata of manifest entry
+type webSeedFileMeta struct {
+	expires  time.Time
+	infoHash *metainfo.Hash
+	size     datasize.ByteSize // 0 - unknown
+	toBlock  uint64            // 0 - unknown
+	priority *int64            // nil - not set
+	checksum *checksum         // nil - not set
+}
+
+// expiresAt - zero if manifest has no expiry info for this file
+func (m *webSeedManifest) expiresAt(name string) time.Time {
+	if meta, ok := m.meta[name]; ok && !meta.expires.IsZero() {
+		return meta.expires
+	}
+	if m.generatedAt.IsZero() || m.ttl == 0 {
+		return time.Time{}
+	}
+	return m.generatedAt.Add(m.ttl)
+}
+
+// maxManifestSize - protect against too big data. Large-catalog chains have manifests of hundreds MB
+const maxManifestSize = 1 * datasize.GB
+
+var errManifestTooBig = fmt.Errorf("manifest is bigger than %s", maxManifestSize.HR())
+
+// decodeWebSeedsManifest - TOML is primary format, JSON with same schema also accepted (detected by first non-space byte: TOML document can't start with '{').
+// Decoding from stream: no extra copy of whole manifest in memory, reading stops after maxManifestSize.
+func decodeWebSeedsManifest(r io.Reader) (*webSeedManifest, error) {
+	br := bufio.NewReader(&manifestSizeLimiter{r: r, left: int64(maxManifestSize.Bytes())})
+	raw := map[string]any{}
+	if isJSON(br) {
+		dec := json.NewDecoder(br)
+		dec.UseNumber()
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		normalizeJSONNumbers(raw)
+		return parseWebSeedsManifest(raw)
+	}
+	if err := toml.NewDecoder(br).Decode(&raw); err != nil {
+		return nil, err
+	}
+	return parseWebSeedsManifest(raw)
+}
+
+// manifestSizeLimiter - unlike io.LimitReader returns error instead of EOF, to not parse truncated manifest
+type manifestSizeLimiter struct {
+	r    io.Reader
+	left int64
+}
+
+func (l *manifestSizeLimiter) Read(p []byte) (n int, err error) {
+	if int64(len(p)) > l.left+1 { // 1 extra byte to distinguish "exactly limit" from "bigger than limit"
+		p = p[:l.left+1]
+	}
+	n, err = l.r.Read(p)
+	l.left -= int64(n)
+	if l.left < 0 {
+		return 0, errManifestTooBig
+	}
+	return n, err
+}
+
+func isJSON(br *bufio.Reader) bool {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return false
+		}
+		if !unicode.IsSpace(rune(b)) {
+			_ = br.UnreadByte()
+			return b == '{'
+		}
+	}
+}
+
+// normalizeJSONNumbers - to same types as TOML decoder produces: int64 or float64
+func normalizeJSONNumbers(m map[string]any) {
+	for k, v := range m {
+		switch v := v.(type) {
+		case json.Number:
+			if i, err := v.Int64(); err == nil {
+				m[k] = i
+			} else if f, err := v.Float64(); err == nil {
+				m[k] = f
+			}
+		case map[string]any:
+			normalizeJSONNumbers(v)
+		}
+	}
+}
+
+func parseWebSeedsManifest(raw map[string]any) (*webSeedManifest, error) {
+	m := &webSeedManifest{files: make(snaptype.WebSeedsFromProvider, len(raw)), schemaVersion: 1}
+	for k, v := range raw {
+		switch k {
+		case manifestKeyRateLimit:
+			limit, err := parseByteSize(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			m.rateLimit = limit
+			continue
+		case manifestKeyChain:
+			chain, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: unexpected type %T", k, v)
+			}
+			m.chain = strings.TrimSpace(chain)
+			continue
+		case manifestKeyNext:
+			next, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: unexpected type %T", k, v)
+			}
+			m.next = strings.TrimSpace(next)
+			continue
+		case manifestKeyEntries:
+			entries, ok := v.(int64)
+			if !ok || entries < 1 {
+				return nil, fmt.Errorf("%s: expected positive integer, got %v", k, v)
+			}
+			m.entries = entries
+			continue
+		case manifestKeySchema:
+			version, ok := v.(int64)
+			if !ok || version < 1 {
+				return nil, fmt.Errorf("%s: expected positive integer, got %v", k, v)
+			}
+			m.schemaVersion = version
+			continue
+		case manifestKeyGeneratedAt:
+			t, err := parseTime(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			m.generatedAt = t
+			continue
+		case manifestKeyTTL:
+			ttl, err := parseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			m.ttl = ttl
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			m.files[k] = v
+		case map[string]any:
+			url, meta, err := parseManifestEntry(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			m.files[k] = url
+			if m.meta == nil {
+				m.meta = map[string]*webSeedFileMeta{}
+			}
+			m.meta[k] = meta
+		default: // unknown keys and fields of future versions of manifest
+		}
+	}
+	return m, nil
+}
+
+func parseManifestEntry(raw map[string]any) (url string, meta *webSeedFileMeta, err error) {
+	url, ok := raw[entryKeyUrl].(string)
+	if !ok {
+		return "", nil, fmt.Errorf("entry has no %q", entryKeyUrl)
+	}
+	meta = &webSeedFileMeta{}
+	if v, ok := raw[entryKeyExpires]; ok {
+		if meta.expires, err = parseTime(v); err != nil {
+			return "", nil, fmt.Errorf("%s: %w", entryKeyExpires, err)
+		}
+	}
+	if v, ok := raw[entryKeyInfoHash]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return "", nil, fmt.Errorf("%s: unexpected type %T", entryKeyInfoHash, v)
+		}
+		var h metainfo.Hash
+		if err := h.FromHexString(strings.TrimSpace(s)); err != nil {
+			return "", nil, fmt.Errorf("%s: %w", entryKeyInfoHash, err)
+		}
+		meta.infoHash = &h
+	}
+	if v, ok := raw[entryKeyToBlock]; ok {
+		toBlock, ok := v.(int64)
+		if !ok || toBlock < 1 {
+			return "", nil, fmt.Errorf("%s: expected positive integer, got %v", entryKeyToBlock, v)
+		}
+		meta.toBlock = uint64(toBlock)
+	}
+	if v, ok := raw[entryKeyPriority]; ok {
+		priority, ok := v.(int64)
+		if !ok {
+			return "", nil, fmt.Errorf("%s: expected integer, got %v", entryKeyPriority, v)
+		}
+		meta.priority = &priority
+	}
+	if v, ok := raw[entryKeySize]; ok {
+		if meta.size, err = parseByteSize(v); err != nil {
+			return "", nil, fmt.Errorf("%s: %w", entryKeySize, err)
+		}
+	}
+	if v, ok := raw[entryKeyChecksum]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return "", nil, fmt.Errorf("%s: unexpected type %T", entryKeyChecksum, v)
+		}
+		if meta.checksum, err = parseChecksum([]byte(s)); err != nil { // unknown algorithm - error: file must not be accepted without verification
+			return "", nil, fmt.Errorf("%s: %w", entryKeyChecksum, err)
+		}
+	}
+	return url, meta, nil
+}
+
+// parseTime - toml datetime or RFC3339 string. Local datetime (without offset) treated as UTC
+func parseTime(v any) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case toml.LocalDateTime:
+		return v.AsTime(time.UTC), nil
+	case toml.LocalDate:
+		return v.AsTime(time.UTC), nil
+	case string:
+		return time.Parse(time.RFC3339, strings.TrimSpace(v))
+	default:
+		return time.Time{}, fmt.Errorf("unexpected type %T", v)
+	}
+}
+
+// parseDuration - "24h" or number of seconds
+func parseDuration(v any) (time.Duration, error) {
+	switch v := v.(type) {
+	case string:
+		return time.ParseDuration(strings.TrimSpace(v))
+	case int64:
+		return time.Duration(v) * time.Second, nil
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	default:
+		return 0, fmt.Errorf("unexpected type %T", v)
+	}
+}
+
+// parseByteSize - "10mb" or number of bytes
+func parseByteSize(v any) (datasize.ByteSize, error) {
+	switch v := v.(type) {
+	case string:
+		var res datasize.ByteSize
+		if err := res.UnmarshalText([]byte(strings.TrimSpace(v))); err != nil {
+			return 0, err
+		}
+		return res, nil
+	case int64:
+		if v < 0 {
+			return 0, fmt.Errorf("negative size: %d", v)
+		}
+		return datasize.ByteSize(v), nil
+	case float64:
+		if v < 0 {
+			return 0, fmt.Errorf("negative size: %f", v)
+		}
+		return datasize.ByteSize(v), nil
+	default:
+		return 0, fmt.Errorf("unexpected type %T", v)
+	}
+}
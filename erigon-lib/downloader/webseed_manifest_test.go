@@ -0,0 +1,169 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/ledgerwatch/erigon-lib/downloader/snaptype"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsManifestExpiry(t *testing.T) {
+	require := require.New(t)
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`
+generated_at = 2020-01-01T00:00:00Z
+ttl = "24h"
+"a.seg" = "https://a.com/a.seg?sig=old"
+"b.seg" = { url = "https://a.com/b.seg", expires = 2999-01-01T00:00:00Z }
+"c.seg" = { url = "https://a.com/c.seg", expires = "2020-01-01T00:00:00Z" }
+`), 0644))
+	ws := newTestWebSeeds(t, nil)
+	m, err := ws.readWebSeedsFile(manifest)
+	require.NoError(err)
+	require.Equal(3, len(m.files))
+	require.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), m.expiresAt("a.seg").UTC())
+
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+	_, ok := ws.ByFileName("a.seg")
+	require.False(ok)
+	_, ok = ws.ByFileName("b.seg")
+	require.True(ok)
+	_, ok = ws.ByFileName("c.seg")
+	require.False(ok)
+}
+
+func TestWebSeedsManifestSchemaVersion(t *testing.T) {
+	require := require.New(t)
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`
+schema_version = 2
+"a.seg" = "https://a.com/a.seg"
+`), 0644))
+
+	ws := newTestWebSeeds(t, nil)
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+	require.Equal(1, ws.Len())
+
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedStrictSchema: true})
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+	require.Equal(0, ws.Len())
+
+	_, err := decodeWebSeedsManifest(bytes.NewReader([]byte(`schema_version = "two"`)))
+	require.Error(err)
+	m, err := decodeWebSeedsManifest(bytes.NewReader([]byte(`"a.seg" = "https://a.com/a.seg"`)))
+	require.NoError(err)
+	require.Equal(int64(1), m.schemaVersion)
+}
+
+func TestWebSeedsManifestJSON(t *testing.T) {
+	require := require.New(t)
+	m, err := decodeWebSeedsManifest(bytes.NewReader([]byte(`
+  {
+	"schema_version": 1,
+	"rate_limit": 1048576,
+	"a.seg": "https://a.com/a.seg",
+	"b.seg": {"url": "https://a.com/b.seg", "expires": "2999-01-01T00:00:00Z", "size": 100}
+  }`)))
+	require.NoError(err)
+	require.Equal(snaptype.WebSeedsFromProvider{"a.seg": "https://a.com/a.seg", "b.seg": "https://a.com/b.seg"}, m.files)
+	require.Equal(datasize.MB, m.rateLimit)
+	require.Equal(datasize.ByteSize(100), m.meta["b.seg"].size)
+	require.Equal(2999, m.expiresAt("b.seg").Year())
+
+	_, err = decodeWebSeedsManifest(bytes.NewReader([]byte(`{"a.seg": `)))
+	require.Error(err)
+}
+
+func TestManifestSizeLimiter(t *testing.T) {
+	require := require.New(t)
+	_, err := io.ReadAll(&manifestSizeLimiter{r: bytes.NewReader(make([]byte, 10)), left: 10})
+	require.NoError(err)
+	_, err = io.ReadAll(&manifestSizeLimiter{r: bytes.NewReader(make([]byte, 11)), left: 10})
+	require.ErrorIs(err, errManifestTooBig)
+}
+
+func TestWebSeedsManifestPages(t *testing.T) {
+	require := require.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/webseeds.toml":
+			_, _ = w.Write([]byte(`next = "page2.toml"
+"a.seg" = "https://a.com/a.seg"`))
+		case "/page2.toml":
+			_, _ = w.Write([]byte(`"b.seg" = "https://a.com/b.seg"`))
+		case "/loop.toml":
+			_, _ = w.Write([]byte(`next = "/loop.toml"`))
+		}
+	}))
+	defer srv.Close()
+	ws := newTestWebSeeds(t, nil)
+
+	u, err := url.Parse(srv.URL + "/webseeds.toml")
+	require.NoError(err)
+	m, err := ws.callHttpProvider(context.Background(), u)
+	require.NoError(err)
+	require.Equal(2, len(m.files))
+
+	u, err = url.Parse(srv.URL + "/loop.toml")
+	require.NoError(err)
+	_, err = ws.callHttpProvider(context.Background(), u)
+	require.Error(err)
+}
+
+func TestWebSeedsManifestChain(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	goerli, mainnet, undeclared := filepath.Join(dir, "goerli.toml"), filepath.Join(dir, "mainnet.toml"), filepath.Join(dir, "undeclared.toml")
+	require.NoError(os.WriteFile(goerli, []byte(`chain = "goerli"
+"a.seg" = "https://a.com/a.seg"`), 0644))
+	require.NoError(os.WriteFile(mainnet, []byte(`chain = "mainnet"
+"b.seg" = "https://a.com/b.seg"`), 0644))
+	require.NoError(os.WriteFile(undeclared, []byte(`"c.seg" = "https://a.com/c.seg"`), 0644))
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{ChainName: "mainnet"})
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{goerli, mainnet, undeclared})
+	_, ok := ws.ByFileName("a.seg")
+	require.False(ok)
+	require.Equal(2, ws.Len())
+}
+
+func TestWebSeedsManifestEntryCount(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+	complete := write("complete.toml", `entries = 2
+"a.seg" = "https://a.com/a.seg"
+"a.seg.torrent" = "https://a.com/a.seg.torrent"`)
+	truncated := write("truncated.toml", `entries = 3
+"b.seg" = "https://a.com/b.seg"
+"b.seg.torrent" = "https://a.com/b.seg.torrent"`)
+	undeclared := write("undeclared.toml", `"c.seg" = "https://a.com/c.seg"`)
+
+	ws := newTestWebSeeds(t, nil)
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{complete, truncated, undeclared})
+	_, ok := ws.ByFileName("a.seg")
+	require.True(ok)
+	_, ok = ws.ByFileName("b.seg")
+	require.False(ok)
+	_, ok = ws.ByFileName("c.seg")
+	require.True(ok)
+
+	_, err := decodeWebSeedsManifest(strings.NewReader(`entries = "2"`))
+	require.ErrorContains(err, "entries")
+}
@@ -0,0 +1,56 @@
+package downloader
+
+import (
+	"context"
+)
+
+// Pause - for maintenance windows: Discover doesn't start new work until Resume. Nothing is lost:
+//   - Discover called while paused waits (before calling any provider) until Resume
+//   - running Discover stops scheduling .torrent downloads, in-flight requests and saves complete
+//   - discovered urls stay available, paused Discover continues from where it stopped after Resume
+//
+// CancelDiscovery works while paused: waiting run returns (publishing nothing new if it didn't call providers yet),
+// but pause stays - next Discover waits for Resume too.
+func (d *WebSeeds) Pause() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.resumed != nil {
+		return
+	}
+	d.resumed = make(chan struct{})
+	d.logger.Info("[snapshots] webseed discovery paused")
+}
+
+// Resume - releases Discover runs waiting after Pause. No-op if not paused
+func (d *WebSeeds) Resume() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.resumed == nil {
+		return
+	}
+	close(d.resumed)
+	d.resumed = nil
+	d.logger.Info("[snapshots] webseed discovery resumed")
+}
+
+func (d *WebSeeds) Paused() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.resumed != nil
+}
+
+// waitResumed - returns immediately if not paused, error only if ctx is done while paused
+func (d *WebSeeds) waitResumed(ctx context.Context) error {
+	d.lock.Lock()
+	resumed := d.resumed
+	d.lock.Unlock()
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,54 @@
+package downloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsPause(t *testing.T) {
+	require := require.New(t)
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`"a.seg" = "https://a.com/a.seg"`), 0644))
+	ws := newTestWebSeeds(t, nil)
+	ws.Resume() // not paused - no-op
+	ws.Pause()
+	ws.Pause()
+	require.True(ws.Paused())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ws.Discover(context.Background(), nil, nil, []string{manifest}, t.TempDir())
+	}()
+	select {
+	case <-done:
+		t.Fatal("discovery must wait for Resume")
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.Equal(0, ws.Len())
+	ws.Resume()
+	<-done
+	require.False(ws.Paused())
+	require.Equal(1, ws.Len())
+
+	ws.Pause()
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		ws.Discover(context.Background(), nil, nil, nil, t.TempDir())
+	}()
+	require.Eventually(func() bool {
+		ws.lock.Lock()
+		defer ws.lock.Unlock()
+		return ws.discoveryCancel != nil
+	}, time.Second, time.Millisecond)
+	ws.CancelDiscovery()
+	<-done
+	require.True(ws.Paused())
+	require.Equal(1, ws.Len()) // state of previous run
+}
@@ -0,0 +1,22 @@
+package downloader
+
+import "strings"
+
+// DefaultFilePriority - of files without `priority` in manifest. Producers may set negative priority to defer files
+const DefaultFilePriority int64 = 0
+
+// priorityKey - entry may be named by data file or by its .torrent file
+func priorityKey(name string) string {
+	return strings.TrimSuffix(name, ".torrent")
+}
+
+// PriorityFor - download priority of file `name` (data file or its .torrent) hinted by manifest of last Discover: higher - earlier.
+// For torrent client to order downloads. If many providers set it - of last one (same as other per-file metadata)
+func (d *WebSeeds) PriorityFor(name string) int64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if p, ok := d.priorities[priorityKey(name)]; ok {
+		return p
+	}
+	return DefaultFilePriority
+}
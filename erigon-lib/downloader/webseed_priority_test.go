@@ -0,0 +1,40 @@
+package downloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsTorrentsWhenSnapStop(t *testing.T) {
+	require := require.New(t)
+	require.False(newTestWebSeeds(t, &downloadercfg.Cfg{SnapStop: true}).downloadTorrentFile)
+	require.True(newTestWebSeeds(t, &downloadercfg.Cfg{SnapStop: true, WebSeedTorrentsWhenSnapStop: true}).downloadTorrentFile)
+	require.False(newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedTorrentsWhenSnapStop: true}).downloadTorrentFile)
+}
+
+func TestWebSeedsPriorityFor(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`
+"v1-010000-010500-headers.seg" = { url = "https://example.com/v1-010000-010500-headers.seg", priority = 10 }
+"v1-000000-000500-bodies.seg.torrent" = { url = "https://example.com/v1-000000-000500-bodies.seg.torrent", priority = -5 }
+"v1-000000-000500-headers.seg" = "https://example.com/v1-000000-000500-headers.seg"
+`), 0644))
+	ws := newTestWebSeeds(t, nil)
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+	require.EqualValues(10, ws.PriorityFor("v1-010000-010500-headers.seg"))
+	require.EqualValues(10, ws.PriorityFor("v1-010000-010500-headers.seg.torrent"))
+	require.EqualValues(-5, ws.PriorityFor("v1-000000-000500-bodies.seg"))
+	require.Equal(DefaultFilePriority, ws.PriorityFor("v1-000000-000500-headers.seg"))
+	require.Equal(DefaultFilePriority, ws.PriorityFor("unknown.seg"))
+
+	_, err := decodeWebSeedsManifest(strings.NewReader(`"a.seg" = { url = "https://example.com/a.seg", priority = "high" }`))
+	require.ErrorContains(err, "priority")
+}
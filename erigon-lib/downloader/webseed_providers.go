@@ -0,0 +1,44 @@
+package downloader
+
+import (
+	"context"
+	"net/url"
+)
+
+// webSeedProviders - set of providers used by DiscoverConfigured. Never modified after creation: replaced as a whole
+type webSeedProviders struct {
+	s3tokens []string
+	urls     []*url.URL
+	files    []string
+}
+
+func newWebSeedProviders(s3tokens []string, urls []*url.URL, files []string) *webSeedProviders {
+	return &webSeedProviders{
+		s3tokens: append([]string(nil), s3tokens...),
+		urls:     append([]*url.URL(nil), urls...),
+		files:    append([]string(nil), files...),
+	}
+}
+
+// SetProviders - hot reload of providers (for example, on SIGHUP or by admin api). Takes effect on next DiscoverConfigured:
+// run in progress completes with old set. To apply immediately: SetProviders, CancelDiscovery, DiscoverConfigured
+func (d *WebSeeds) SetProviders(s3tokens []string, urls []*url.URL, files []string) {
+	p := newWebSeedProviders(s3tokens, urls, files)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.providers = p
+}
+
+// Providers - current set, initially from WebSeedS3Tokens, WebSeedUrls, WebSeedFiles of config
+func (d *WebSeeds) Providers() (s3tokens []string, urls []*url.URL, files []string) {
+	d.lock.Lock()
+	p := d.providers
+	d.lock.Unlock()
+	return append([]string(nil), p.s3tokens...), append([]*url.URL(nil), p.urls...), append([]string(nil), p.files...)
+}
+
+// DiscoverConfigured - Discover with current providers (see SetProviders). Set is taken once, when run starts
+// (after waiting for run in progress): whole run uses same set
+func (d *WebSeeds) DiscoverConfigured(ctx context.Context, rootDir string) error {
+	return d.discover(ctx, nil, rootDir)
+}
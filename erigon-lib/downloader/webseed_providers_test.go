@@ -0,0 +1,63 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsSetProviders(t *testing.T) {
+	require := require.New(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow/webseeds.toml" {
+			close(started)
+			<-release
+		}
+		fmt.Fprintf(w, `"%s.seg" = "https://example.com/a.seg"`, strings.Split(r.URL.Path, "/")[1])
+	}))
+	defer srv.Close()
+	provider := func(name string) *url.URL {
+		u, err := url.Parse(srv.URL + "/" + name + "/webseeds.toml")
+		require.NoError(err)
+		return u
+	}
+	names := func(ws *WebSeeds) (res []string) {
+		ws.ForEachFile(func(name string, _ metainfo.UrlList) bool {
+			res = append(res, name)
+			return true
+		})
+		return res
+	}
+
+	urls := []*url.URL{provider("a")}
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedUrls: urls})
+	require.NoError(ws.DiscoverConfigured(context.Background(), t.TempDir()))
+	require.Equal([]string{"a.seg"}, names(ws))
+
+	ws.SetProviders(nil, []*url.URL{provider("b"), provider("c")}, nil)
+	_, gotUrls, _ := ws.Providers()
+	require.Len(gotUrls, 2)
+	require.NoError(ws.DiscoverConfigured(context.Background(), t.TempDir()))
+	require.ElementsMatch([]string{"b.seg", "c.seg"}, names(ws))
+
+	// run in progress completes with set it started with
+	ws.SetProviders(nil, []*url.URL{provider("slow")}, nil)
+	done := make(chan error, 1)
+	go func() { done <- ws.DiscoverConfigured(context.Background(), t.TempDir()) }()
+	<-started
+	ws.SetProviders(nil, []*url.URL{provider("d")}, nil)
+	close(release)
+	require.NoError(<-done)
+	require.Equal([]string{"slow.seg"}, names(ws))
+	require.NoError(ws.DiscoverConfigured(context.Background(), t.TempDir()))
+	require.Equal([]string{"d.seg"}, names(ws))
+}
@@ -0,0 +1,165 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+
+	"golang.org/x/time/rate"
+)
+
+// applyRateLimitHints - token bucket per host of urls listed by manifest which advertised `rate_limit`.
+// Must be called under lock.
+func (d *WebSeeds) applyRateLimitHints(m *webSeedManifest) {
+	if m.rateLimit == 0 {
+		return
+	}
+	if d.hostLimiters == nil {
+		d.hostLimiters = map[string]*rate.Limiter{}
+	}
+	limit := rate.Limit(m.rateLimit.Bytes())
+	burst := int(m.rateLimit.Bytes())
+	if burst < minRateLimitBurst {
+		burst = minRateLimitBurst
+	}
+	for _, wUrl := range m.files {
+		u, err := url.Parse(wUrl)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		if l, ok := d.hostLimiters[u.Host]; ok {
+			l.SetLimit(limit)
+			l.SetBurst(burst)
+			continue
+		}
+		d.hostLimiters[u.Host] = rate.NewLimiter(limit, burst)
+	}
+}
+
+const minRateLimitBurst = 32 * 1024
+
+// limiterFor - advertised by provider, or global download limit
+func (d *WebSeeds) limiterFor(host string) *rate.Limiter {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if l, ok := d.hostLimiters[host]; ok {
+		return l
+	}
+	return d.globalLimiter
+}
+
+func (d *WebSeeds) rateLimitedReader(ctx context.Context, host string, r io.Reader) io.Reader {
+	l := d.limiterFor(host)
+	if l == nil || l.Limit() == rate.Inf || l.Burst() <= 0 {
+		return r
+	}
+	return &rateLimitedReader{ctx: ctx, r: r, limiter: l}
+}
+
+type rateLimitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if burst := r.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.limiter.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// defaults are generous: don't slow down discovery, but protect shared mirrors from unbounded bursts of .torrent downloads
+const (
+	defaultWebSeedHostRequestRate = 50
+	defaultWebSeedRequestRate     = 200
+)
+
+func requestRateOrDefault(rps, def float64) float64 {
+	if rps == 0 {
+		return def
+	}
+	return rps
+}
+
+// newRequestLimiter - token bucket of requests, nil - unlimited
+func newRequestLimiter(rps, def float64) *rate.Limiter {
+	rps = requestRateOrDefault(rps, def)
+	if rps < 0 {
+		return nil
+	}
+	burst := int(rps)
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(rps), burst)
+}
+
+// waitRequestRate - before each request to provider
+func (d *WebSeeds) waitRequestRate(ctx context.Context, host string) error {
+	if d.hostRequestRate > 0 {
+		d.lock.Lock()
+		l, ok := d.hostRequestLimiters[host]
+		if !ok {
+			l = newRequestLimiter(d.hostRequestRate, 0)
+			if d.hostRequestLimiters == nil {
+				d.hostRequestLimiters = map[string]*rate.Limiter{}
+			}
+			d.hostRequestLimiters[host] = l
+		}
+		d.lock.Unlock()
+		if err := l.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if d.requestLimiter != nil {
+		return d.requestLimiter.Wait(ctx)
+	}
+	return nil
+}
+
+func globalDownloadLimiter(cfg *downloadercfg.Cfg) *rate.Limiter {
+	if cfg.ClientConfig == nil {
+		return nil
+	}
+	return cfg.ClientConfig.DownloadRateLimiter
+}
+
+// budgetBody - counts bytes of all responses into byte budget of current Discover run
+type budgetBody struct {
+	io.ReadCloser
+	d *WebSeeds
+}
+
+func (b *budgetBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	if n > 0 {
+		b.d.lock.Lock()
+		b.d.bytesUsed += uint64(n)
+		b.d.lock.Unlock()
+	}
+	return n, err
+}
+
+func (d *WebSeeds) resetByteBudget() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.bytesUsed = 0
+}
+
+func (d *WebSeeds) byteBudgetExceeded() bool {
+	if d.byteBudget == 0 {
+		return false
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.bytesUsed >= d.byteBudget.Bytes()
+}
@@ -0,0 +1,87 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestWebSeedsManifestRateLimit(t *testing.T) {
+	require := require.New(t)
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`
+rate_limit = "1mb"
+"a.seg" = "https://a.com/a.seg"
+`), 0644))
+	ws := newTestWebSeeds(t, nil)
+	m, err := ws.readWebSeedsFile(manifest)
+	require.NoError(err)
+	require.Equal(1, len(m.files))
+	require.Equal(datasize.MB, m.rateLimit)
+
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+	require.Equal(rate.Limit(datasize.MB.Bytes()), ws.limiterFor("a.com").Limit())
+	require.Nil(ws.limiterFor("b.com"))
+}
+
+func TestWebSeedsDiscoveryByteBudget(t *testing.T) {
+	require := require.New(t)
+	torrent := testTorrentBytes(t, "a.seg")
+	var srvUrl string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/webseeds.toml" {
+			_, _ = fmt.Fprintf(w, `"a.seg.torrent" = "%[1]s/a.seg.torrent"
+"b.seg.torrent" = "%[1]s/b.seg.torrent"`, srvUrl)
+			return
+		}
+		_, _ = w.Write(torrent)
+	}))
+	defer srv.Close()
+	srvUrl = srv.URL
+	u, err := url.Parse(srv.URL + "/webseeds.toml")
+	require.NoError(err)
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedDiscoveryByteBudget: datasize.B})
+	ws.downloadTorrentFile = true
+	ws.Discover(context.Background(), nil, []*url.URL{u}, nil, t.TempDir())
+	require.Equal(2, ws.Stats().MissingTorrents) // manifest already exceeded budget
+
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedDiscoveryByteBudget: datasize.MB})
+	ws.downloadTorrentFile = true
+	ws.Discover(context.Background(), nil, []*url.URL{u}, nil, t.TempDir())
+	require.Equal(0, ws.Stats().MissingTorrents)
+}
+
+func TestWebSeedsRequestRate(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedHostRequestRate: 10, WebSeedRequestRate: -1})
+	require.Nil(ws.requestLimiter)
+	start := time.Now()
+	for i := 0; i < 15; i++ { // burst 10, then 10 req/s
+		require.NoError(ws.waitRequestRate(ctx, "a.com"))
+	}
+	require.GreaterOrEqual(time.Since(start), 400*time.Millisecond)
+	start = time.Now()
+	require.NoError(ws.waitRequestRate(ctx, "b.com")) // own bucket
+	require.Less(time.Since(start), 100*time.Millisecond)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.Error(ws.waitRequestRate(cancelled, "a.com"))
+
+	ws = newTestWebSeeds(t, nil)
+	require.Equal(float64(defaultWebSeedHostRequestRate), ws.hostRequestRate)
+	require.Equal(rate.Limit(defaultWebSeedRequestRate), ws.requestLimiter.Limit())
+}
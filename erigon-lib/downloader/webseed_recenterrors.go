@@ -0,0 +1,70 @@
+package downloader
+
+import "time"
+
+const defaultRecentErrors = 100
+
+// RecentProviderError - failure of webseed provider during Discover, see WebSeeds.RecentErrors
+type RecentProviderError struct {
+	Time     time.Time
+	Provider string // redacted url, s3 bucket/key or file path
+	Category ProviderErrCategory
+	Err      error
+}
+
+// recentErrors - ring buffer: memory is bounded, oldest errors overwritten
+type recentErrors struct {
+	buf  []RecentProviderError
+	next int  // position of next write
+	full bool // buf wrapped at least once: oldest is at `next`
+}
+
+// newRecentErrors - nil if disabled. nil is valid (no-op) buffer
+func newRecentErrors(capacity int) *recentErrors {
+	if capacity < 0 {
+		return nil
+	}
+	if capacity == 0 {
+		capacity = defaultRecentErrors
+	}
+	return &recentErrors{buf: make([]RecentProviderError, capacity)}
+}
+
+func (r *recentErrors) add(e RecentProviderError) {
+	if r == nil {
+		return
+	}
+	r.buf[r.next] = e
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *recentErrors) capacity() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.buf)
+}
+
+// list - copy, oldest first
+func (r *recentErrors) list() []RecentProviderError {
+	if r == nil {
+		return nil
+	}
+	if !r.full {
+		return append([]RecentProviderError(nil), r.buf[:r.next]...)
+	}
+	res := make([]RecentProviderError, 0, len(r.buf))
+	res = append(res, r.buf[r.next:]...)
+	return append(res, r.buf[:r.next]...)
+}
+
+// RecentErrors - last provider errors (up to WebSeedRecentErrors), oldest first. Kept across Discover runs:
+// shows intermittent failures which scrolled past in logs
+func (d *WebSeeds) RecentErrors() []RecentProviderError {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.recentErrors.list()
+}
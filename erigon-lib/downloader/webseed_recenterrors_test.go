@@ -0,0 +1,41 @@
+package downloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsRecentErrors(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.toml")
+	require.NoError(os.WriteFile(bad, []byte("not toml ="), 0644))
+	missing := filepath.Join(dir, "missing.toml")
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedRecentErrors: 3})
+	require.Empty(ws.RecentErrors())
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{bad, missing})
+	errs := ws.RecentErrors()
+	require.Len(errs, 2)
+	require.Equal(bad, errs[0].Provider)
+	require.Equal(ProviderErrParse, errs[0].Category)
+	require.Error(errs[0].Err)
+	require.False(errs[0].Time.IsZero())
+	require.Equal(missing, errs[1].Provider)
+
+	// bounded: oldest overwritten
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{missing, bad})
+	errs = ws.RecentErrors()
+	require.Len(errs, 3)
+	require.Equal([]string{missing, missing, bad}, []string{errs[0].Provider, errs[1].Provider, errs[2].Provider})
+
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedRecentErrors: -1})
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{bad})
+	require.Empty(ws.RecentErrors())
+	require.Equal(1, ws.Stats().ProviderErrors[ProviderErrParse])
+}
@@ -0,0 +1,152 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// Resumable manifest downloads: interrupted download of large manifest continues from received offset by
+// `Range` request (validated by `If-Range`), instead of starting from scratch. Body goes to temp file,
+// decoded only when complete. If server doesn't support ranges (or file changed) - downloaded again from start.
+const (
+	resumableManifestMinSize = 16 * datasize.MB // smaller manifests are decoded from body, as before
+	defaultManifestResumes   = 3
+)
+
+// resumableManifest - response of first page request is worth resuming: big enough and has known size
+func (d *WebSeeds) resumableManifest(resp *http.Response) bool {
+	return d.manifestResumes > 0 && resp.StatusCode == http.StatusOK &&
+		resp.ContentLength >= d.manifestResumeMinSize && resp.ContentLength <= int64(maxManifestSize.Bytes())
+}
+
+// downloadResumableManifest - consumes `resp` (first response, 200), decodes assembled file
+func (d *WebSeeds) downloadResumableManifest(ctx context.Context, u *url.URL, resp *http.Response) (*webSeedManifest, error) {
+	f, err := os.CreateTemp("", "webseed-manifest-")
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+
+	total := resp.ContentLength
+	validator := resp.Header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") { // weak etag can't be used with If-Range
+		validator = resp.Header.Get("Last-Modified")
+	}
+	ranges := resp.Header.Get("Accept-Ranges") == "bytes" && validator != "" && d.supportsRange(u.Host)
+
+	var written int64
+	for attempt := 0; ; attempt++ {
+		n, err := io.Copy(f, io.LimitReader(checkTruncation(resp), int64(maxManifestSize.Bytes())+1-written))
+		resp.Body.Close()
+		written += n
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt >= d.manifestResumes {
+			return nil, newProviderErr(ProviderErrOther, err)
+		}
+		d.logRequest(u, "[snapshots] webseed manifest download interrupted, resuming", "url", redactUrl(u), "received", written, "size", total, "ranges", ranges, "err", err)
+		if resp, written, total, err = d.resumeManifest(ctx, u, f, written, total, validator, ranges); err != nil {
+			return nil, err
+		}
+	}
+	if total >= 0 && written != total {
+		return nil, newProviderErr(ProviderErrOther, fmt.Errorf("%w: got %d of %d bytes", ErrTruncatedResponse, written, total))
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	response, err := decodeWebSeedsManifest(f)
+	if err != nil {
+		return nil, newProviderErr(ProviderErrParse, err)
+	}
+	return response, nil
+}
+
+// resumeManifest - requests rest of file from `offset` (or whole file if ranges not supported, or server ignored range).
+// Returns response to continue copying from, offset in `f` it continues at, and size of file (-1 if unknown)
+func (d *WebSeeds) resumeManifest(ctx context.Context, u *url.URL, f *os.File, offset, total int64, validator string, ranges bool) (*http.Response, int64, int64, error) {
+	request, err := d.newRequest(ctx, http.MethodGet, u)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if ranges {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		request.Header.Set("If-Range", validator)
+	}
+	resp, err := d.do(request)
+	if err != nil {
+		return nil, 0, 0, classifyNetworkErr(err)
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || start != offset || (total >= 0 && size != total) {
+			resp.Body.Close()
+			return nil, 0, 0, newProviderErr(ProviderErrStatus, fmt.Errorf("unexpected Content-Range %q, requested from %d of %d", resp.Header.Get("Content-Range"), offset, total))
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			resp.Body.Close()
+			return nil, 0, 0, err
+		}
+		return resp, offset, total, nil
+	case http.StatusOK: // no ranges, or file changed since first response (If-Range not matched): start over
+		if resp.ContentLength > int64(maxManifestSize.Bytes()) {
+			resp.Body.Close()
+			return nil, 0, 0, newProviderErr(ProviderErrOther, fmt.Errorf("unexpected Content-Length %d of manifest", resp.ContentLength))
+		}
+		if err := f.Truncate(0); err != nil {
+			resp.Body.Close()
+			return nil, 0, 0, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			resp.Body.Close()
+			return nil, 0, 0, err
+		}
+		return resp, 0, resp.ContentLength, nil
+	default:
+		resp.Body.Close()
+		return nil, 0, 0, newProviderErr(ProviderErrStatus, fmt.Errorf("unexpected http status: %s", resp.Status))
+	}
+}
+
+var errInvalidContentRange = errors.New("invalid Content-Range")
+
+// parseContentRange - `bytes <start>-<end>/<size>`, size must be known
+func parseContentRange(s string) (start, size int64, err error) {
+	s, ok := strings.CutPrefix(s, "bytes ")
+	if !ok {
+		return 0, 0, errInvalidContentRange
+	}
+	rng, sizeStr, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, 0, errInvalidContentRange
+	}
+	startStr, endStr, ok := strings.Cut(rng, "-")
+	if !ok {
+		return 0, 0, errInvalidContentRange
+	}
+	start, err1 := strconv.ParseInt(startStr, 10, 64)
+	end, err2 := strconv.ParseInt(endStr, 10, 64)
+	size, err3 := strconv.ParseInt(sizeStr, 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || start < 0 || end < start || end >= size {
+		return 0, 0, errInvalidContentRange
+	}
+	return start, size, nil
+}
@@ -0,0 +1,103 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsResumableManifest(t *testing.T) {
+	require := require.New(t)
+	manifest := &bytes.Buffer{}
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(manifest, "\"v1-%06d-%06d-headers.seg\" = \"https://a.com/v1-%06d-%06d-headers.seg\"\n", i, i+1, i, i+1)
+	}
+	data := manifest.Bytes()
+	t.Setenv("TMPDIR", t.TempDir())
+
+	newServer := func(ranges bool) (*httptest.Server, *[]string) {
+		var requests []string
+		var lock sync.Mutex
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			requests = append(requests, r.Header.Get("Range"))
+			first := len(requests) == 1
+			lock.Unlock()
+			w.Header().Set("ETag", `"v1"`)
+			if first { // connection dropped in the middle
+				w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+				if ranges {
+					w.Header().Set("Accept-Ranges", "bytes")
+				}
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write(data[:len(data)/2])
+				w.(http.Flusher).Flush()
+				conn, _, err := w.(http.Hijacker).Hijack()
+				require.NoError(err)
+				conn.Close()
+				return
+			}
+			if !ranges {
+				r.Header.Del("Range")
+				_, _ = w.Write(data)
+				return
+			}
+			http.ServeContent(w, r, "webseeds.toml", time.Time{}, bytes.NewReader(data))
+		}))
+		t.Cleanup(srv.Close)
+		return srv, &requests
+	}
+	call := func(cfg *downloadercfg.Cfg, srv *httptest.Server, capabilities ...ProviderCapabilities) (*webSeedManifest, error) {
+		ws := newTestWebSeeds(t, cfg)
+		ws.manifestResumeMinSize = 1
+		u, err := url.Parse(srv.URL + "/webseeds.toml")
+		require.NoError(err)
+		for _, c := range capabilities {
+			ws.capabilities = map[string]ProviderCapabilities{u.Host: c}
+		}
+		return ws.callHttpProviderPage(context.Background(), u)
+	}
+
+	srv, requests := newServer(true)
+	m, err := call(&downloadercfg.Cfg{}, srv)
+	require.NoError(err)
+	require.Len(m.files, 100)
+	require.Equal([]string{"", fmt.Sprintf("bytes=%d-", len(data)/2)}, *requests)
+
+	// no ranges: downloaded again from start
+	srv, requests = newServer(false)
+	m, err = call(&downloadercfg.Cfg{}, srv)
+	require.NoError(err)
+	require.Len(m.files, 100)
+	require.Equal([]string{"", ""}, *requests)
+
+	// probe found no ranges: Range not sent, even if response claims support
+	srv, requests = newServer(true)
+	m, err = call(&downloadercfg.Cfg{}, srv, ProviderCapabilities{Head: true})
+	require.NoError(err)
+	require.Len(m.files, 100)
+	require.Equal([]string{"", ""}, *requests)
+
+	srv, requests = newServer(true)
+	_, err = call(&downloadercfg.Cfg{WebSeedManifestResumes: -1}, srv)
+	require.Error(err)
+	require.Len(*requests, 1)
+
+	start, size, err := parseContentRange("bytes 10-19/20")
+	require.NoError(err)
+	require.Equal(int64(10), start)
+	require.Equal(int64(20), size)
+	for _, s := range []string{"bytes 10-19/*", "bytes */20", "bytes 10-20/20", "items 0-1/2"} {
+		_, _, err = parseContentRange(s)
+		require.ErrorIs(err, errInvalidContentRange, s)
+	}
+}
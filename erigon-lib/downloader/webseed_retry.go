@@ -0,0 +1,43 @@
+package downloader
+
+import (
+	"net/http"
+	"time"
+)
+
+const defaultRetryBackoff = 500 * time.Millisecond
+
+// defaultIsRetryable - network errors and statuses which mean "try later": 429 and 5xx
+func defaultIsRetryable(resp *http.Response, err error) bool {
+	return err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+func isRetryableOrDefault(f func(resp *http.Response, err error) bool) func(resp *http.Response, err error) bool {
+	if f == nil {
+		return defaultIsRetryable
+	}
+	return f
+}
+
+// doWithRetries - requests to providers have no body, so same request can be sent again.
+// Response of last attempt is returned as is: caller handles its status as without retries
+func (d *WebSeeds) doWithRetries(request *http.Request) (*http.Response, error) {
+	ctx := request.Context()
+	for attempt := 0; ; attempt++ {
+		resp, err := d.doAttempt(request)
+		if attempt >= d.retries || ctx.Err() != nil || !d.isRetryable(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		d.logRequest(request.URL, "[snapshots] webseed request retry", "url", redactUrl(request.URL), "attempt", attempt+1, "err", err)
+		timer := time.NewTimer(d.retryBackoff << attempt)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
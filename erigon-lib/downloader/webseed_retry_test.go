@@ -0,0 +1,56 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsRetries(t *testing.T) {
+	require := require.New(t)
+	var calls atomic.Int32
+	failures := int32(2)
+	status := http.StatusServiceUnavailable
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		fmt.Fprint(w, `"a.seg" = "https://example.com/a.seg"`)
+	}))
+	defer srv.Close()
+	provider, err := url.Parse(srv.URL + "/webseeds.toml")
+	require.NoError(err)
+	discover := func(cfg *downloadercfg.Cfg) int {
+		calls.Store(0)
+		ws := newTestWebSeeds(t, cfg)
+		ws.retryBackoff = time.Millisecond
+		ws.downloadWebseedTomlFromProviders(context.Background(), nil, []*url.URL{provider}, nil)
+		return ws.Len()
+	}
+
+	require.Zero(discover(&downloadercfg.Cfg{}))
+	require.EqualValues(1, calls.Load())
+	require.Equal(1, discover(&downloadercfg.Cfg{WebSeedRetries: 2}))
+	require.EqualValues(3, calls.Load())
+	require.Zero(discover(&downloadercfg.Cfg{WebSeedRetries: 1}))
+	require.EqualValues(2, calls.Load())
+
+	// 404 is final by default, callback may override it
+	status = http.StatusNotFound
+	require.Zero(discover(&downloadercfg.Cfg{WebSeedRetries: 2}))
+	require.EqualValues(1, calls.Load())
+	cache404 := func(resp *http.Response, err error) bool {
+		return err != nil || resp.StatusCode == http.StatusNotFound
+	}
+	require.Equal(1, discover(&downloadercfg.Cfg{WebSeedRetries: 2, WebSeedIsRetryable: cache404}))
+	require.EqualValues(3, calls.Load())
+}
@@ -0,0 +1,216 @@
+package downloader
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go"
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+)
+
+const defaultS3ObjectKey = "webseeds.toml"
+
+type s3Token struct {
+	accountId, accessKeyId, accessKeySecret string
+	objectKey                               string    // key of manifest in bucket
+	backups                                 []s3Token // tried in order if credentials rejected, only credentials fields are set
+
+	// only for `s3://` tokens: credentials by aws default chain (env, shared config, IMDS, IRSA)
+	defaultChain     bool
+	bucket           string
+	endpoint, region string // empty - resolved by aws sdk
+}
+
+// parseS3Token - format: `v1:base64(accountId:accessKeyId:accessKeySecret)[:objectKey]`
+// optional objectKey allows one bucket serve manifests of many chains, for example: `v1:dG9rZW4=:mainnet/webseeds.toml`
+//
+// tokenInBase64 may have backup credentials for rotation windows: `v1:primaryBase64|backupBase64[:objectKey]`.
+// Each of them may be reference to file: `v1:@/path/to/creds[:objectKey]` - file has base64 token, it's read on each call (rotation works).
+// File must not be accessible by group/others.
+//
+// or `s3://bucket[/objectKey][?region=us-east-1&endpoint=https://...]` - no keys in token, they are taken from aws default credentials chain.
+// Useful on EC2/EKS with instance/IRSA role.
+func parseS3Token(token string) (s3Token, error) {
+	if strings.HasPrefix(token, "s3://") {
+		return parseS3Url(token)
+	}
+	l := strings.SplitN(token, ":", 3)
+	if len(l) < 2 {
+		return s3Token{}, fmt.Errorf("token has invalid format, exepcing 'v1:tokenInBase64'")
+	}
+	version, tokenInBase64 := strings.TrimSpace(l[0]), strings.TrimSpace(l[1])
+	if version != "v1" {
+		return s3Token{}, fmt.Errorf("not supported version: %s", version)
+	}
+	objectKey := defaultS3ObjectKey
+	if len(l) == 3 && strings.TrimSpace(l[2]) != "" {
+		objectKey = strings.TrimSpace(l[2])
+	}
+	alternatives := strings.Split(tokenInBase64, "|")
+	t, err := parseS3Credentials(strings.TrimSpace(alternatives[0]))
+	if err != nil {
+		return s3Token{}, err
+	}
+	t.objectKey = objectKey
+	for i, alternative := range alternatives[1:] {
+		backup, err := parseS3Credentials(strings.TrimSpace(alternative))
+		if err != nil {
+			return s3Token{}, fmt.Errorf("backup credentials %d: %w", i+1, err)
+		}
+		t.backups = append(t.backups, backup)
+	}
+	return t, nil
+}
+
+func parseS3Credentials(tokenInBase64 string) (s3Token, error) {
+	if strings.HasPrefix(tokenInBase64, "@") {
+		var err error
+		if tokenInBase64, err = readS3TokenFile(tokenInBase64[1:]); err != nil {
+			return s3Token{}, err
+		}
+	}
+	rawDecodedText, err := base64.StdEncoding.DecodeString(tokenInBase64)
+	if err != nil {
+		return s3Token{}, err
+	}
+	l := strings.Split(string(rawDecodedText), ":")
+	if len(l) != 3 {
+		return s3Token{}, fmt.Errorf("token has invalid format, exepcing 'accountId:accessKeyId:accessKeySecret'")
+	}
+	return s3Token{
+		accountId:       strings.TrimSpace(l[0]),
+		accessKeyId:     strings.TrimSpace(l[1]),
+		accessKeySecret: strings.TrimSpace(l[2]),
+	}, nil
+}
+
+// s3EndpointOf - validates endpoints of all chains (config may be shared by nodes of different chains), returns one of `chainName`
+func s3EndpointOf(endpoints map[string]downloadercfg.S3Endpoint, chainName string) (*downloadercfg.S3Endpoint, error) {
+	for chain, e := range endpoints {
+		if chain == "" {
+			return nil, fmt.Errorf("webseed s3 endpoint: empty chain name")
+		}
+		u, err := url.Parse(strings.ReplaceAll(e.Endpoint, "{account}", "account"))
+		if err != nil {
+			return nil, fmt.Errorf("webseed s3 endpoint of %s: %w", chain, err)
+		}
+		if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, fmt.Errorf("webseed s3 endpoint of %s: expecting http(s) url, got %q", chain, e.Endpoint)
+		}
+	}
+	e, ok := endpoints[chainName]
+	if !ok {
+		return nil, nil
+	}
+	return &e, nil
+}
+
+// s3AuthErrCodes - credentials rejected: revoked, expired or wrong
+var s3AuthErrCodes = map[string]struct{}{
+	"InvalidAccessKeyId":    {},
+	"SignatureDoesNotMatch": {},
+	"AccessDenied":          {},
+	"ExpiredToken":          {},
+	"InvalidToken":          {},
+	"Unauthorized":          {},
+}
+
+func isS3AuthErr(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		if _, ok := s3AuthErrCodes[apiErr.ErrorCode()]; ok {
+			return true
+		}
+	}
+	var statusErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &statusErr) {
+		return statusErr.HTTPStatusCode() == http.StatusUnauthorized || statusErr.HTTPStatusCode() == http.StatusForbidden
+	}
+	return false
+}
+
+// readS3TokenFile - errors never contain file content
+func readS3TokenFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		return "", fmt.Errorf("s3 token file %s is accessible by other users (%s), expecting 0600 or stricter", path, info.Mode().Perm())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func parseS3Url(token string) (s3Token, error) {
+	u, err := url.Parse(strings.TrimSpace(token))
+	if err != nil {
+		return s3Token{}, err
+	}
+	if u.Host == "" {
+		return s3Token{}, fmt.Errorf("token has invalid format, exepcing 's3://bucket[/objectKey]'")
+	}
+	objectKey := strings.TrimPrefix(u.Path, "/")
+	if objectKey == "" {
+		objectKey = defaultS3ObjectKey
+	}
+	q := u.Query()
+	return s3Token{
+		defaultChain: true,
+		bucket:       u.Host,
+		objectKey:    objectKey,
+		endpoint:     q.Get("endpoint"),
+		region:       q.Get("region"),
+	}, nil
+}
+
+// S3CredentialsFromFile - file has same format as s3 token: `v1:base64(accountId:accessKeyId:accessKeySecret)`.
+// File re-read once credentials older than `refreshEvery` - operators can rotate keys by updating file/secret without restart.
+func S3CredentialsFromFile(path string, refreshEvery time.Duration) aws.CredentialsProvider {
+	return aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return aws.Credentials{}, err
+		}
+		t, err := parseS3Token(strings.TrimSpace(string(data)))
+		if err != nil {
+			return aws.Credentials{}, fmt.Errorf("credentials file %s: %w", path, err)
+		}
+		return aws.Credentials{
+			AccessKeyID:     t.accessKeyId,
+			SecretAccessKey: t.accessKeySecret,
+			Source:          "erigon-webseed-file",
+			CanExpire:       refreshEvery > 0,
+			Expires:         time.Now().Add(refreshEvery),
+		}, nil
+	})
+}
+
+// checkS3ManifestAge - with `s3MaxManifestAge`: replica lagging behind serves old object. Unknown LastModified is not checked
+func (d *WebSeeds) checkS3ManifestAge(bucket, key string, lastModified *time.Time) error {
+	if d.s3MaxManifestAge == 0 {
+		return nil
+	}
+	if lastModified == nil || lastModified.IsZero() {
+		d.logger.Debug("[snapshots] s3 webseed manifest has no LastModified, age not checked", "bucket", bucket, "key", key)
+		return nil
+	}
+	age := time.Since(*lastModified).Truncate(time.Second)
+	d.logger.Log(d.verbosity, "[snapshots] s3 webseed manifest", "bucket", bucket, "key", key, "age", age)
+	if age > d.s3MaxManifestAge {
+		return newProviderErr(ProviderErrOther, fmt.Errorf("%w: s3 object last modified %s ago, max age %s", ErrStaleManifest, age, d.s3MaxManifestAge))
+	}
+	return nil
+}
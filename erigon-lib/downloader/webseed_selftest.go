@@ -0,0 +1,174 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SelfTestStage - step of provider pipeline checked by WebSeeds.SelfTest, in order of execution
+type SelfTestStage string
+
+const (
+	SelfTestManifest SelfTestStage = "manifest" // fetch (or read) webseeds.toml, all pages
+	SelfTestSchema   SelfTestStage = "schema"   // schema_version, chain, amount of entries
+	SelfTestTorrent  SelfTestStage = "torrent"  // download 1 .torrent file listed by manifest
+	SelfTestValidate SelfTestStage = "validate" // decode it, compare with info_hash of manifest (if declared)
+	SelfTestCleanup  SelfTestStage = "cleanup"  // remove temp dir
+)
+
+// SelfTestStageResult - Err is nil if stage passed
+type SelfTestStageResult struct {
+	Stage SelfTestStage
+	Err   error
+	Took  time.Duration
+}
+
+// SelfTestResult - stages of 1 provider. Stages after failed one are not executed (except cleanup) and not listed
+type SelfTestResult struct {
+	Provider string // redacted url, s3 bucket/key or file path
+	Stages   []SelfTestStageResult
+}
+
+func (r SelfTestResult) Passed() bool {
+	for _, s := range r.Stages {
+		if s.Err != nil {
+			return false
+		}
+	}
+	return len(r.Stages) > 0
+}
+
+// SelfTest - runs whole pipeline against each provider: manifest, its validation, download and validation of 1 .torrent file.
+// Read-only: .torrent file goes to temp dir (removed after), state of WebSeeds (discovered files, etags, ...) is not changed.
+// Its requests don't feed byte budget, latency and weights of hosts: may run concurrently with Discover.
+// Unlike Discover, errors are not tolerated: first failed stage fails provider.
+func (d *WebSeeds) SelfTest(ctx context.Context, s3tokens []string, urls []*url.URL, files []string) []SelfTestResult {
+	ctx = withAccounting(ctx, accountNone)
+	res := make([]SelfTestResult, 0, len(s3tokens)+len(urls)+len(files))
+	for _, u := range urls {
+		u := u
+		res = append(res, d.selfTestProvider(ctx, redactUrl(u), func() (*webSeedManifest, error) { return d.callUrlProvider(ctx, u) }))
+	}
+	for _, token := range s3tokens {
+		token := token
+		res = append(res, d.selfTestProvider(ctx, d.s3ProviderName(token), func() (*webSeedManifest, error) { return d.callS3Provider(ctx, token) }))
+	}
+	for _, path := range files {
+		path := path
+		res = append(res, d.selfTestProvider(ctx, path, func() (*webSeedManifest, error) { return d.readWebSeedsFile(path) }))
+	}
+	return res
+}
+
+func (d *WebSeeds) selfTestProvider(ctx context.Context, provider string, fetch func() (*webSeedManifest, error)) (res SelfTestResult) {
+	res.Provider = provider
+	run := func(stage SelfTestStage, f func() error) bool {
+		start := time.Now()
+		err := f()
+		res.Stages = append(res.Stages, SelfTestStageResult{Stage: stage, Err: err, Took: time.Since(start)})
+		return err == nil
+	}
+
+	var manifest *webSeedManifest
+	if !run(SelfTestManifest, func() (err error) {
+		manifest, err = fetch()
+		return err
+	}) {
+		return res
+	}
+	if !run(SelfTestSchema, func() error { return d.checkManifest(manifest) }) {
+		return res
+	}
+
+	dir, err := os.MkdirTemp("", "webseed-selftest-")
+	if err != nil {
+		run(SelfTestTorrent, func() error { return err })
+		return res
+	}
+	defer run(SelfTestCleanup, func() error { return os.RemoveAll(dir) })
+
+	var torrent *downloadedTorrent
+	var name string
+	if !run(SelfTestTorrent, func() (err error) {
+		torrent, name, err = d.selfTestDownloadTorrent(ctx, manifest, dir)
+		return err
+	}) {
+		return res
+	}
+	defer torrent.discard()
+	run(SelfTestValidate, func() error {
+		if _, err := torrent.mi.UnmarshalInfo(); err != nil {
+			return err
+		}
+		if meta, ok := manifest.meta[name]; ok && meta.infoHash != nil && *meta.infoHash != torrent.hash {
+			return fmt.Errorf("%s: info-hash %s, manifest declares %s", name, torrent.hash.HexString(), meta.infoHash.HexString())
+		}
+		return nil
+	})
+	return res
+}
+
+// checkManifest - same rules as filterBySchemaVersion, filterByChain, filterByEntryCount, filterByMaxEntries (of 1 manifest), but as error
+func (d *WebSeeds) checkManifest(m *webSeedManifest) error {
+	if d.strictSchema && m.schemaVersion > webSeedsSchemaVersion {
+		return fmt.Errorf("unsupported schema_version %d, supported %d", m.schemaVersion, webSeedsSchemaVersion)
+	}
+	if m.chain != "" && d.chainName != "" && m.chain != d.chainName {
+		return fmt.Errorf("manifest is for chain %q, expected %q", m.chain, d.chainName)
+	}
+	if m.entries > 0 && m.entries != int64(len(m.files)) {
+		return fmt.Errorf("manifest declares %d entries, has %d", m.entries, len(m.files))
+	}
+	if d.maxManifestEntries > 0 && len(m.files) > d.maxManifestEntries {
+		return fmt.Errorf("manifest has %d entries, limit %d", len(m.files), d.maxManifestEntries)
+	}
+	if len(m.files) == 0 {
+		return errors.New("manifest is empty")
+	}
+	return nil
+}
+
+// selfTestDownloadTorrent - first (by name) usable .torrent entry. Plain GET: no etags, no retries over other urls
+func (d *WebSeeds) selfTestDownloadTorrent(ctx context.Context, m *webSeedManifest, dir string) (*downloadedTorrent, string, error) {
+	names := make([]string, 0, len(m.files))
+	for name, wUrl := range m.files {
+		if !strings.HasSuffix(name, ".torrent") || isMagnet(wUrl) || !d.allowedHosts.allowedUrl(wUrl) || (d.requireHTTPS && !secureRawUrl(wUrl)) {
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, "", errors.New("manifest has no usable .torrent entries")
+	}
+	sort.Strings(names)
+	name := names[0]
+	u, err := url.ParseRequestURI(m.files[name])
+	if err != nil {
+		return nil, name, err
+	}
+	request, err := d.newRequest(ctx, http.MethodGet, u)
+	if err != nil {
+		return nil, name, err
+	}
+	resp, err := d.do(request)
+	if err != nil {
+		return nil, name, classifyNetworkErr(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, name, newProviderErr(ProviderErrStatus, fmt.Errorf("%s: unexpected http status: %s", name, resp.Status))
+	}
+	res, err := streamTorrent(osFS{}, dir, filepath.Base(name), checkTruncation(resp))
+	if err != nil {
+		return nil, name, fmt.Errorf("%s: %w", name, err)
+	}
+	return res, name, nil
+}
@@ -0,0 +1,83 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsSelfTest(t *testing.T) {
+	require := require.New(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok/webseeds.toml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `
+"a.seg.torrent" = "http://%[1]s/a.seg.torrent"
+"b.seg.torrent" = "http://%[1]s/b.seg.torrent"
+"a.seg" = "http://%[1]s/a.seg"
+`, r.Host)
+	})
+	mux.HandleFunc("/other-chain/webseeds.toml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "chain = \"goerli\"\n\"a.seg.torrent\" = \"http://%s/a.seg.torrent\"\n", r.Host)
+	})
+	mux.HandleFunc("/bad-hash/webseeds.toml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "\"a.seg.torrent\" = { url = \"http://%s/a.seg.torrent\", info_hash = \"%040x\" }\n", r.Host, 1)
+	})
+	mux.HandleFunc("/a.seg.torrent", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testTorrentBytes(t, "a.seg"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{ChainName: "mainnet", WebSeedDiscoveryByteBudget: datasize.MB, WebSeedWeightDecay: 0.5})
+	providers := []*url.URL{}
+	for _, p := range []string{"/ok/webseeds.toml", "/other-chain/webseeds.toml", "/bad-hash/webseeds.toml", "/missing/webseeds.toml"} {
+		u, err := url.Parse(srv.URL + p)
+		require.NoError(err)
+		providers = append(providers, u)
+	}
+	res := ws.SelfTest(context.Background(), nil, providers, nil)
+	require.Len(res, 4)
+
+	stages := func(r SelfTestResult) (names []SelfTestStage, failed SelfTestStage) {
+		for _, s := range r.Stages {
+			names = append(names, s.Stage)
+			if s.Err != nil {
+				failed = s.Stage
+			}
+		}
+		return names, failed
+	}
+	names, failed := stages(res[0])
+	require.True(res[0].Passed())
+	require.Equal([]SelfTestStage{SelfTestManifest, SelfTestSchema, SelfTestTorrent, SelfTestValidate, SelfTestCleanup}, names)
+	require.Empty(failed)
+	require.Equal(srv.URL+"/ok/webseeds.toml", res[0].Provider)
+
+	_, failed = stages(res[1])
+	require.False(res[1].Passed())
+	require.Equal(SelfTestSchema, failed)
+	_, failed = stages(res[2])
+	require.Equal(SelfTestValidate, failed)
+	_, failed = stages(res[3])
+	require.Equal(SelfTestManifest, failed)
+
+	// read-only: nothing discovered, temp dirs removed, budget and stats of Discover runs not touched
+	require.Zero(ws.Len())
+	require.Zero(ws.bytesUsed)
+	require.Nil(ws.latency)
+	require.Empty(ws.adaptiveWeights)
+	require.Empty(ws.Stats().ProviderErrors)
+	entries, err := os.ReadDir(tmpDir)
+	require.NoError(err)
+	require.Empty(entries)
+}
@@ -0,0 +1,99 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// callSFTPProvider - reads manifest from `sftp://user@host[:port]/path/to/webseeds.toml`.
+// Auth by private key `sshKeyFile`, host key verified by `sshKnownHosts` (default: ~/.ssh/known_hosts).
+func (d *WebSeeds) callSFTPProvider(ctx context.Context, u *url.URL) (*webSeedManifest, error) {
+	sshCfg, err := d.sshClientConfig(u)
+	if err != nil {
+		return nil, err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, classifyNetworkErr(err)
+	}
+	defer conn.Close()
+	// ssh and sftp libs don't accept ctx: interrupt them by closing connection
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, sshCfg)
+	if err != nil {
+		return nil, classifyNetworkErr(err)
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+	defer client.Close()
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return nil, err
+	}
+	defer sftpClient.Close()
+	f, err := sftpClient.Open(u.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	response, err := decodeWebSeedsManifest(f)
+	if err != nil {
+		return nil, newProviderErr(ProviderErrParse, err)
+	}
+	return response, nil
+}
+
+func (d *WebSeeds) sshClientConfig(u *url.URL) (*ssh.ClientConfig, error) {
+	if d.sshKeyFile == "" {
+		return nil, fmt.Errorf("sftp webseed provider requires ssh key file")
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("sftp webseed provider requires user: sftp://user@host/path")
+	}
+	key, err := os.ReadFile(d.sshKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("ssh key %s: %w", d.sshKeyFile, err)
+	}
+	knownHostsFile := d.sshKnownHosts
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("known_hosts: %w", err)
+	}
+	return &ssh.ClientConfig{
+		User:            u.User.Username(),
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+	}, nil
+}
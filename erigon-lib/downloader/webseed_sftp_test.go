@@ -0,0 +1,146 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// startTestSFTPServer - in-process read-only sftp server of local fs, accepting only user `erigon` with `clientKey`
+func startTestSFTPServer(t *testing.T, clientKey ssh.PublicKey) (addr string, hostKey ssh.PublicKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "erigon" && bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key of %s", conn.User())
+		},
+	}
+	cfg.AddHostKey(hostSigner)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+		for newChannel := range chans {
+			if newChannel.ChannelType() != "session" {
+				_ = newChannel.Reject(ssh.UnknownChannelType, "session only")
+				continue
+			}
+			channel, requests, err := newChannel.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				for req := range requests {
+					ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+					_ = req.Reply(ok, nil)
+					if !ok {
+						continue
+					}
+					server, err := sftp.NewServer(channel, sftp.ReadOnly())
+					if err != nil {
+						channel.Close()
+						return
+					}
+					go func() {
+						defer channel.Close()
+						_ = server.Serve()
+					}()
+				}
+			}()
+		}
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return l.Addr().String(), hostSigner.PublicKey()
+}
+
+func TestWebSeedsSFTPProvider(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	writeKey := func(name string) ssh.PublicKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(err)
+		der, err := x509.MarshalECPrivateKey(key)
+		require.NoError(err)
+		require.NoError(os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600))
+		pub, err := ssh.NewPublicKey(&key.PublicKey)
+		require.NoError(err)
+		return pub
+	}
+	clientKey := writeKey("id_ecdsa")
+	writeKey("other_ecdsa")
+	root := filepath.Join(dir, "srv")
+	require.NoError(os.MkdirAll(filepath.Join(root, "mainnet"), 0755))
+	require.NoError(os.WriteFile(filepath.Join(root, "mainnet", "webseeds.toml"), []byte(`"a.seg" = "https://a.com/a.seg"`), 0644))
+	addr, hostKey := startTestSFTPServer(t, clientKey)
+	knownHosts := filepath.Join(dir, "known_hosts")
+	require.NoError(os.WriteFile(knownHosts, []byte(knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostKey)+"\n"), 0600))
+	ctx := context.Background()
+	u, err := url.Parse("sftp://erigon@" + addr + filepath.ToSlash(root) + "/mainnet/webseeds.toml")
+	require.NoError(err)
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedSSHKeyFile: filepath.Join(dir, "id_ecdsa"), WebSeedSSHKnownHosts: knownHosts})
+	m, err := ws.callUrlProvider(ctx, u)
+	require.NoError(err)
+	require.Equal("https://a.com/a.seg", m.files["a.seg"])
+
+	_, err = ws.callUrlProvider(ctx, u.JoinPath("..", "missing.toml"))
+	require.Error(err)
+	_, err = ws.callUrlProvider(ctx, &url.URL{Scheme: "sftp", Host: addr, Path: u.Path}) // no user
+	require.ErrorContains(err, "requires user")
+
+	// not authorized key
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedSSHKeyFile: filepath.Join(dir, "other_ecdsa"), WebSeedSSHKnownHosts: knownHosts})
+	_, err = ws.callUrlProvider(ctx, u)
+	require.ErrorContains(err, "unable to authenticate")
+
+	// host key differs from known_hosts: possible MITM
+	otherHost, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	otherHostKey, err := ssh.NewPublicKey(&otherHost.PublicKey)
+	require.NoError(err)
+	require.NoError(os.WriteFile(knownHosts, []byte(knownhosts.Line([]string{knownhosts.Normalize(addr)}, otherHostKey)+"\n"), 0600))
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedSSHKeyFile: filepath.Join(dir, "id_ecdsa"), WebSeedSSHKnownHosts: knownHosts})
+	_, err = ws.callUrlProvider(ctx, u)
+	require.ErrorContains(err, "key mismatch")
+
+	// unknown host
+	require.NoError(os.WriteFile(knownHosts, nil, 0600))
+	_, err = ws.callUrlProvider(ctx, u)
+	require.ErrorContains(err, "key is unknown")
+}
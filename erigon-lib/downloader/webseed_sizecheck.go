@@ -0,0 +1,88 @@
+package downloader
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/c2h5oh/datasize"
+	"golang.org/x/sync/errgroup"
+)
+
+const sizeConsistencyWorkers = 16
+
+// checkSizeConsistency - HEADs each url of sampled files with multiple urls and warns if mirrors disagree about size:
+// mirror with old version of file causes torrent verification failures later. Returns amount of files with disagreement
+func (d *WebSeeds) checkSizeConsistency(ctx context.Context) (mismatches int) {
+	if d.sizeConsistencySample <= 0 {
+		return 0
+	}
+	var lock sync.Mutex
+	e, ctx := errgroup.WithContext(ctx)
+	e.SetLimit(sizeConsistencyWorkers)
+	d.ForEachFile(func(name string, urls metainfo.UrlList) bool {
+		if len(urls) < 2 || rand.Float64() >= d.sizeConsistencySample {
+			return true
+		}
+		e.Go(func() error {
+			sizes := make([]int64, len(urls))
+			var known int64 = -1
+			consistent := true
+			for i, u := range urls {
+				sizes[i] = d.headSize(ctx, u)
+				if sizes[i] < 0 {
+					continue
+				}
+				if known >= 0 && sizes[i] != known {
+					consistent = false
+				}
+				known = sizes[i]
+			}
+			if consistent {
+				return nil
+			}
+			lock.Lock()
+			mismatches++
+			lock.Unlock()
+			args := []interface{}{"name", name}
+			for i, u := range urls {
+				parsed, _ := url.Parse(u)
+				size := "unknown"
+				if sizes[i] >= 0 {
+					size = datasize.ByteSize(sizes[i]).HR()
+				}
+				args = append(args, redactUrl(parsed), size)
+			}
+			d.logger.Warn("[snapshots] webseed mirrors have different size of same file, one of them is stale", args...)
+			return nil
+		})
+		return ctx.Err() == nil
+	})
+	_ = e.Wait()
+	return mismatches
+}
+
+// headSize - Content-Length of url, -1 if unknown
+func (d *WebSeeds) headSize(ctx context.Context, rawUrl string) int64 {
+	u, err := url.Parse(rawUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return -1
+	}
+	request, err := d.newRequest(ctx, http.MethodHead, u)
+	if err != nil {
+		return -1
+	}
+	resp, err := d.do(request)
+	if err != nil {
+		d.logger.Debug("[snapshots] webseed HEAD", "url", redactUrl(u), "err", err)
+		return -1
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return -1
+	}
+	return resp.ContentLength
+}
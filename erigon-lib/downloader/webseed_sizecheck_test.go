@@ -0,0 +1,39 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/ledgerwatch/erigon-lib/downloader/snaptype"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsSizeConsistency(t *testing.T) {
+	require := require.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(http.MethodHead, r.Method)
+		size := 100
+		if strings.HasPrefix(r.URL.Path, "/stale/") {
+			size = 90
+		}
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", size))
+	}))
+	defer srv.Close()
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedSizeConsistencySample: 1})
+	ws.Merge(snaptype.WebSeedUrls{
+		"a.seg": {srv.URL + "/fresh/a.seg", srv.URL + "/stale/a.seg"},
+		"b.seg": {srv.URL + "/fresh/b.seg", srv.URL + "/fresh2/b.seg"},
+		"c.seg": {srv.URL + "/stale/c.seg"}, // single url - nothing to compare
+	}, nil)
+	require.Equal(1, ws.checkSizeConsistency(context.Background()))
+
+	ws = newTestWebSeeds(t, nil) // disabled by default
+	ws.Merge(snaptype.WebSeedUrls{"a.seg": {srv.URL + "/fresh/a.seg", srv.URL + "/stale/a.seg"}}, nil)
+	require.Equal(0, ws.checkSizeConsistency(context.Background()))
+}
@@ -0,0 +1,71 @@
+package downloader
+
+import (
+	"github.com/ledgerwatch/log/v3"
+)
+
+// SkipReason - why discovered file (or one of its urls) is not used
+type SkipReason string
+
+const (
+	SkipFilesFilter          SkipReason = "files-filter"            // not matching WebSeedFilesFilter
+	SkipExpired              SkipReason = "expired"                 // url expired by manifest's `expires`
+	SkipListedBefore         SkipReason = "listed-before"           // ManifestMergeFillGaps: already listed by previous provider
+	SkipHostNotAllowed       SkipReason = "host-not-allowed"        // by WebSeedAllowedHosts
+	SkipInvalidUrl           SkipReason = "invalid-url"             //
+	SkipInsecureUrl          SkipReason = "insecure-url"            // plain http url while WebSeedRequireHTTPS
+	SkipUnexpectedHost       SkipReason = "unexpected-host"         // url not matching WebSeedExpectedHosts
+	SkipExists               SkipReason = "exists"                  // .torrent file already on disk
+	SkipUnsupported          SkipReason = "unsupported"             // by WebSeedSkipTorrent
+	SkipByteBudget           SkipReason = "byte-budget"             // WebSeedDiscoveryByteBudget exceeded
+	SkipDeadline             SkipReason = "deadline"                // WebSeedTorrentsMaxDuration exceeded
+	SkipDiskCapacity         SkipReason = "disk-capacity"           // not enough free space or inodes
+	SkipFetchFailed          SkipReason = "fetch-failed"            // no url returned valid .torrent (unavailable, oversized, invalid)
+	SkipInfoHashMismatch     SkipReason = "info-hash-mismatch"      // .torrent doesn't match info_hash of manifest
+	SkipNotApproved          SkipReason = "not-approved"            // by WebSeedShouldDownload
+	SkipTorrentUrlNotAllowed SkipReason = "torrent-url-not-allowed" // .torrent has tracker or webseed of host not in WebSeedAllowedHosts
+	SkipUnsafePath           SkipReason = "unsafe-path"             // .torrent file would be written outside of dir (`..` or symlink)
+	SkipBeforeCutoff         SkipReason = "before-cutoff"           // data file ends before WebSeedTorrentsCutoffBlock
+)
+
+// logSkip - each file logged once per Discover run for each reason, at WebSeedSkipLogLevel
+func (d *WebSeeds) logSkip(name string, reason SkipReason, ctx ...interface{}) {
+	key := name + "\x00" + string(reason)
+	d.lock.Lock()
+	if d.skipped == nil {
+		d.skipped = map[string]struct{}{}
+	}
+	_, seen := d.skipped[key]
+	d.skipped[key] = struct{}{}
+	d.lock.Unlock()
+	if seen {
+		return
+	}
+	d.logger.Log(d.skipLogLevel, "[snapshots] webseed skip", append([]interface{}{"name", name, "reason", reason}, ctx...)...)
+}
+
+// skippedByConfig - file not downloaded by decision of config (not failure) in current Discover run: node never needs it
+func (d *WebSeeds) skippedByConfig(name string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, reason := range []SkipReason{SkipUnsupported, SkipBeforeCutoff, SkipNotApproved} {
+		if _, ok := d.skipped[name+"\x00"+string(reason)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *WebSeeds) resetSkipped() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.skipped = nil
+}
+
+// skipLogLevel - LvlCrit is zero value of log.Lvl: means not set
+func skipLogLevel(lvl log.Lvl) log.Lvl {
+	if lvl == log.LvlCrit {
+		return log.LvlDebug
+	}
+	return lvl
+}
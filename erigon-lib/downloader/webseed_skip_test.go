@@ -0,0 +1,110 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsSkipTorrent(t *testing.T) {
+	require := require.New(t)
+	require.True(SkipUnsupportedTorrent("commitment.0-32.v.torrent"))
+	require.True(SkipUnsupportedTorrent("history/commitment.0-32.ef.torrent"))
+	require.False(SkipUnsupportedTorrent("accounts.0-32.v.torrent"))
+	require.False(SkipUnsupportedTorrent("commitment.0-32.kv.torrent"))
+
+	torrent := testTorrentBytes(t, "commitment.0-32.v")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(torrent)
+	}))
+	defer srv.Close()
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(fmt.Sprintf(`"commitment.0-32.v.torrent" = "%s/commitment.0-32.v.torrent"`, srv.URL)), 0644))
+	for _, cfg := range []*downloadercfg.Cfg{{}, {WebSeedSkipTorrent: func(string) bool { return false }}} {
+		dir := t.TempDir()
+		ws := newTestWebSeeds(t, cfg)
+		ws.downloadTorrentFile = true
+		ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+		ws.downloadTorrentFilesFromProviders(context.Background(), dir)
+		_, err := os.Stat(filepath.Join(dir, "commitment.0-32.v.torrent"))
+		require.Equal(cfg.WebSeedSkipTorrent != nil, err == nil)
+	}
+}
+
+func TestWebSeedsSkipLog(t *testing.T) {
+	require := require.New(t)
+	require.Equal(log.LvlDebug, skipLogLevel(log.LvlCrit))
+	require.Equal(log.LvlInfo, skipLogLevel(log.LvlInfo))
+
+	dir := t.TempDir()
+	require.NoError(os.WriteFile(filepath.Join(dir, "a.seg.torrent"), testTorrentBytes(t, "a.seg"), 0644))
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`"a.seg.torrent" = "https://a.com/a.seg.torrent"
+"b.seg" = "https://evil.com/b.seg"
+"c.seg" = "https://a.com/c.seg"`), 0644))
+
+	var lock sync.Mutex
+	reasons := map[string][]SkipReason{}
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedAllowedHosts: []string{"a.com"}, WebSeedSkipLogLevel: log.LvlInfo})
+	ws.logger.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		if r.Msg != "[snapshots] webseed skip" {
+			return nil
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		reasons[r.Ctx[1].(string)] = append(reasons[r.Ctx[1].(string)], r.Ctx[3].(SkipReason))
+		return nil
+	}))
+	ws.downloadTorrentFile = true
+	for i := 0; i < 2; i++ { // logged once
+		ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest, manifest})
+		ws.downloadTorrentFilesFromProviders(context.Background(), dir)
+	}
+	require.Equal(map[string][]SkipReason{"a.seg.torrent": {SkipExists}, "b.seg": {SkipHostNotAllowed}}, reasons)
+}
+
+func TestWebSeedsTorrentsCutoff(t *testing.T) {
+	require := require.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testTorrentBytes(t, strings.TrimSuffix(filepath.Base(r.URL.Path), ".torrent")))
+	}))
+	defer srv.Close()
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(fmt.Sprintf(`
+"v1-000000-000500-headers.seg.torrent" = "%[1]s/v1-000000-000500-headers.seg.torrent"
+"v1-000500-001000-headers.seg.torrent" = "%[1]s/v1-000500-001000-headers.seg.torrent"
+"old.dat.torrent" = { url = "%[1]s/old.dat.torrent", to_block = 400000 }
+"accounts.0-32.kv.torrent" = "%[1]s/accounts.0-32.kv.torrent"
+`, srv.URL)), 0644))
+	for _, c := range []struct {
+		cutoff   uint64
+		expected []string
+	}{
+		{0, []string{"accounts.0-32.kv.torrent", "old.dat.torrent", "v1-000000-000500-headers.seg.torrent", "v1-000500-001000-headers.seg.torrent"}},
+		{500_000, []string{"accounts.0-32.kv.torrent", "v1-000500-001000-headers.seg.torrent"}}, // range unknown - downloaded
+		{1_000_000, []string{"accounts.0-32.kv.torrent"}},
+	} {
+		dir := t.TempDir()
+		ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedTorrentsCutoffBlock: c.cutoff})
+		ws.downloadTorrentFile = true
+		ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+		ws.downloadTorrentFilesFromProviders(context.Background(), dir)
+		entries, err := os.ReadDir(dir)
+		require.NoError(err)
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		require.Equal(c.expected, names, c.cutoff)
+	}
+}
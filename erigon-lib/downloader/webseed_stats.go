@@ -0,0 +1,190 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/ledgerwatch/erigon-lib/common/dir"
+	"github.com/valyala/histogram"
+)
+
+var webseedMissingTorrents = metrics.GetOrCreateCounter(`webseed_missing_torrents`)
+
+// WebSeedsStats - accounting of webseed discovery, for dashboards and diagnostics
+type WebSeedsStats struct {
+	ProviderErrors  map[ProviderErrCategory]int // since start
+	MissingTorrents int                         // .torrent files advertised by providers but not on disk (except skipped by config), after last Discover
+	Latency         map[string]ProviderLatency  // by host, of last Discover
+	// ProviderEntries - by provider (redacted url, s3 bucket/key or file path): entries (data and .torrent files) it contributed
+	// to last completed Discover. Mirror serving near-empty manifest has few. With ManifestMergeFillGaps entries already listed
+	// by previous providers are not counted
+	ProviderEntries map[string]int
+	// HostWeights - adaptive weights by url host (see WebSeedWeightDecay), since start. Host without requests is absent (weight 1)
+	HostWeights map[string]float64
+}
+
+// ProviderLatency - time to response headers
+type ProviderLatency struct {
+	Requests      int
+	P50, P90, P99 time.Duration
+}
+
+// hostLatency - streaming quantiles: memory is bounded regardless of amount of requests
+type hostLatency struct {
+	hist     *histogram.Fast
+	requests int
+}
+
+func (d *WebSeeds) Stats() WebSeedsStats {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	res := WebSeedsStats{ProviderErrors: make(map[ProviderErrCategory]int, len(d.stats.ProviderErrors)), MissingTorrents: d.stats.MissingTorrents, Latency: d.stats.Latency,
+		ProviderEntries: d.stats.ProviderEntries}
+	for k, v := range d.stats.ProviderErrors {
+		res.ProviderErrors[k] = v
+	}
+	if len(d.adaptiveWeights) > 0 {
+		res.HostWeights = make(map[string]float64, len(d.adaptiveWeights))
+		for k, v := range d.adaptiveWeights {
+			res.HostWeights[k] = v
+		}
+	}
+	return res
+}
+
+func (d *WebSeeds) countProviderErr(provider string, err error) {
+	category := ProviderErrCategoryOf(err)
+	metrics.GetOrCreateCounter(fmt.Sprintf(`webseed_provider_errors{category="%s"}`, category)).Inc()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.recentErrors.add(RecentProviderError{Time: time.Now(), Provider: provider, Category: category, Err: err})
+	if d.stats.ProviderErrors == nil {
+		d.stats.ProviderErrors = map[ProviderErrCategory]int{}
+	}
+	d.stats.ProviderErrors[category]++
+	if d.report != nil {
+		d.report.ProvidersContacted++
+		if d.report.ProviderErrors == nil {
+			d.report.ProviderErrors = map[ProviderErrCategory]int{}
+		}
+		d.report.ProviderErrors[category]++
+	}
+}
+
+func (d *WebSeeds) countProviderOk() {
+	d.recordReport(func(r *DiscoveryReport) {
+		r.ProvidersContacted++
+		r.ProvidersOk++
+	})
+}
+
+// DiscoveryReport - machine-parseable summary of 1 Discover run, for log-based monitoring pipelines
+type DiscoveryReport struct {
+	Start              time.Time                   `json:"start"`
+	DurationMs         int64                       `json:"duration_ms"`
+	Cancelled          bool                        `json:"cancelled"`
+	ProvidersContacted int                         `json:"providers_contacted"`
+	ProvidersOk        int                         `json:"providers_ok"`
+	ProviderErrors     map[ProviderErrCategory]int `json:"provider_errors,omitempty"`
+	FilesDiscovered    int                         `json:"files_discovered"`
+	TorrentsDiscovered int                         `json:"torrents_discovered"`
+	TorrentsDownloaded int                         `json:"torrents_downloaded"`
+}
+
+// startReport - report is collected on each run: summary is logged at INFO, and written to `reportWriter` if set
+func (d *WebSeeds) startReport() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.report = &DiscoveryReport{Start: time.Now()}
+}
+
+func (d *WebSeeds) recordReport(f func(r *DiscoveryReport)) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.report != nil {
+		f(d.report)
+	}
+}
+
+func (d *WebSeeds) finishReport(ctx context.Context) {
+	d.lock.Lock()
+	report := d.report
+	d.report = nil
+	if report != nil {
+		report.DurationMs = time.Since(report.Start).Milliseconds()
+		report.Cancelled = ctx.Err() != nil
+		report.FilesDiscovered = len(d.byFileName)
+		report.TorrentsDiscovered = len(d.torrentUrls)
+	}
+	d.lock.Unlock()
+	if report == nil {
+		return
+	}
+	took := time.Duration(report.DurationMs) * time.Millisecond
+	if report.Cancelled {
+		d.logger.Info("[snapshots] webseed discovery cancelled", "providers", report.ProvidersContacted, "took", took)
+	} else {
+		d.logger.Info("[snapshots] webseed discovery", "providers", report.ProvidersContacted, "ok", report.ProvidersOk,
+			"failed", report.ProvidersContacted-report.ProvidersOk, "files", report.FilesDiscovered, "torrents_downloaded", report.TorrentsDownloaded, "took", took)
+	}
+	if d.reportWriter == nil {
+		return
+	}
+	if err := json.NewEncoder(d.reportWriter).Encode(report); err != nil {
+		d.logger.Debug("[snapshots] write discovery report", "err", err)
+	}
+}
+
+// countMissingTorrents - "node still needs to download N .torrent files". Skipped by config (commitment, cutoff, ...) are not needed
+func (d *WebSeeds) countMissingTorrents(rootDir string) {
+	var missing int
+	for name := range d.TorrentUrls() {
+		if !dir.FileExist(filepath.Join(rootDir, name)) && !d.skippedByConfig(name) {
+			missing++
+		}
+	}
+	webseedMissingTorrents.Set(uint64(missing))
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.stats.MissingTorrents = missing
+}
+
+func (d *WebSeeds) observeLatency(host string, took time.Duration) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.latency == nil {
+		d.latency = map[string]*hostLatency{}
+	}
+	l, ok := d.latency[host]
+	if !ok {
+		l = &hostLatency{hist: histogram.NewFast()}
+		d.latency[host] = l
+	}
+	l.hist.Update(float64(took))
+	l.requests++
+}
+
+// finishLatency - logs latency percentiles of providers for current Discover run and publishes them to Stats
+func (d *WebSeeds) finishLatency() {
+	d.lock.Lock()
+	res := make(map[string]ProviderLatency, len(d.latency))
+	for host, l := range d.latency {
+		res[host] = ProviderLatency{
+			Requests: l.requests,
+			P50:      time.Duration(l.hist.Quantile(0.5)),
+			P90:      time.Duration(l.hist.Quantile(0.9)),
+			P99:      time.Duration(l.hist.Quantile(0.99)),
+		}
+	}
+	d.latency = nil
+	d.stats.Latency = res
+	d.lock.Unlock()
+
+	for host, l := range res {
+		d.logger.Log(d.verbosity, "[snapshots] webseed provider latency", "host", host, "requests", l.Requests, "p50", l.P50, "p90", l.P90, "p99", l.P99)
+	}
+}
@@ -0,0 +1,119 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsMissingTorrents(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	require.NoError(os.WriteFile(filepath.Join(dir, "a.seg.torrent"), testTorrentBytes(t, "a.seg"), 0644))
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`
+"a.seg.torrent" = "https://a.com/a.seg.torrent"
+"b.seg.torrent" = "https://a.com/b.seg.torrent"
+`), 0644))
+	ws := newTestWebSeeds(t, nil)
+	ws.Discover(context.Background(), nil, nil, []string{manifest}, dir)
+	require.Equal(1, ws.Stats().MissingTorrents)
+
+	// skipped by config are not needed: not missing. Failed to fetch - missing
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/b.seg.torrent" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(testTorrentBytes(t, strings.TrimSuffix(filepath.Base(r.URL.Path), ".torrent")))
+	}))
+	defer srv.Close()
+	require.NoError(os.WriteFile(manifest, []byte(fmt.Sprintf(`
+"a.seg.torrent" = "%[1]s/a.seg.torrent"
+"b.seg.torrent" = "%[1]s/b.seg.torrent"
+"c.seg.torrent" = "%[1]s/c.seg.torrent"
+"commitment.0-32.v.torrent" = "%[1]s/commitment.0-32.v.torrent"
+`, srv.URL)), 0644))
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{DownloadTorrentFilesFromWebseed: true,
+		WebSeedShouldDownload: func(name string, mi *metainfo.MetaInfo) bool { return name != "c.seg.torrent" }})
+	ws.Discover(context.Background(), nil, nil, []string{manifest}, dir)
+	require.Equal(1, ws.Stats().MissingTorrents) // b. c - not approved, commitment - unsupported
+	require.NoFileExists(filepath.Join(dir, "c.seg.torrent"))
+
+	ws.Discover(context.Background(), nil, nil, []string{manifest}, dir) // counted by each run
+	require.Equal(1, ws.Stats().MissingTorrents)
+}
+
+func TestWebSeedsDiscoveryReport(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`
+"a.seg" = "https://a.com/a.seg"
+"a.seg.torrent" = "https://a.com/a.seg.torrent"
+`), 0644))
+	broken := filepath.Join(dir, "broken.toml")
+	require.NoError(os.WriteFile(broken, []byte(`"a.seg = `), 0644))
+
+	out := &bytes.Buffer{}
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedDiscoveryReport: out})
+	ws.Discover(context.Background(), nil, nil, []string{manifest, broken}, t.TempDir())
+
+	var report DiscoveryReport
+	require.NoError(json.Unmarshal(out.Bytes(), &report))
+	require.Equal(2, report.ProvidersContacted)
+	require.Equal(1, report.ProvidersOk)
+	require.Equal(map[ProviderErrCategory]int{ProviderErrParse: 1}, report.ProviderErrors)
+	require.Equal(1, report.FilesDiscovered)
+	require.Equal(1, report.TorrentsDiscovered)
+	require.False(report.Cancelled)
+
+	// without report writer: only summary at INFO
+	var summary []interface{}
+	ws = newTestWebSeeds(t, nil)
+	ws.logger.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		if r.Msg == "[snapshots] webseed discovery" {
+			require.Equal(log.LvlInfo, r.Lvl)
+			summary = r.Ctx
+		}
+		return nil
+	}))
+	ws.Discover(context.Background(), nil, nil, []string{manifest, broken}, t.TempDir())
+	require.Equal([]interface{}{"providers", 2, "ok", 1, "failed", 1, "files", 1, "torrents_downloaded", 0}, summary[:10])
+}
+
+func TestWebSeedsLatency(t *testing.T) {
+	require := require.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`"a.seg" = "https://a.com/a.seg"`))
+	}))
+	defer srv.Close()
+	var urls []*url.URL
+	for _, p := range []string{"/a/webseeds.toml", "/b/webseeds.toml", "/c/webseeds.toml"} { // different: same providers are deduplicated
+		u, err := url.Parse(srv.URL + p)
+		require.NoError(err)
+		urls = append(urls, u)
+	}
+	u := urls[0]
+	ws := newTestWebSeeds(t, nil)
+	ws.Discover(context.Background(), nil, urls, nil, t.TempDir())
+
+	latency := ws.Stats().Latency[u.Host]
+	require.Equal(3, latency.Requests)
+	require.Greater(latency.P50, time.Duration(0))
+	require.LessOrEqual(latency.P50, latency.P99)
+}
@@ -0,0 +1,912 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/ledgerwatch/erigon-lib/downloader/snaptype"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWebSeeds(t *testing.T, cfg *downloadercfg.Cfg) *WebSeeds {
+	t.Helper()
+	if cfg == nil {
+		cfg = &downloadercfg.Cfg{}
+	}
+	ws, err := NewWebSeeds(cfg, log.New(), log.LvlInfo)
+	require.NoError(t, err)
+	return ws
+}
+
+// trustTestServer - make client trust self-signed cert of httptest server
+func trustTestServer(ws *WebSeeds, srv *httptest.Server) {
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	roundTripper := ws.httpClient.Transport
+	if t, ok := roundTripper.(*http3FallbackTransport); ok {
+		t.h3.TLSClientConfig.RootCAs = pool
+		roundTripper = t.fallback
+	}
+	var transport *http.Transport
+	switch t := roundTripper.(type) {
+	case *hostOverrideTransport:
+		transport = t.base
+	default:
+		transport = t.(*http.Transport)
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.RootCAs = pool
+}
+
+func TestWebSeedsFilesFilter(t *testing.T) {
+	require := require.New(t)
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`
+"v1-000000-000500-headers.seg" = "https://a.com/v1-000000-000500-headers.seg"
+"v1-000000-000500-bodies.seg" = "https://a.com/v1-000000-000500-bodies.seg"
+"v1-000000-000500-headers.seg.torrent" = "https://a.com/v1-000000-000500-headers.seg.torrent"
+"v1-000000-000500-bodies.seg.torrent" = "https://a.com/v1-000000-000500-bodies.seg.torrent"
+"history/v1-accounts.0-32.v" = "https://a.com/history/v1-accounts.0-32.v"
+`), 0644))
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedFilesFilter: []string{"headers", "history/"}})
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+	require.Equal(2, ws.Len())
+	_, ok := ws.ByFileName("v1-000000-000500-headers.seg")
+	require.True(ok)
+	_, ok = ws.ByFileName("history/v1-accounts.0-32.v")
+	require.True(ok)
+	require.Equal(1, len(ws.TorrentUrls()))
+
+	ws = newTestWebSeeds(t, nil)
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+	require.Equal(3, ws.Len())
+	require.Equal(2, len(ws.TorrentUrls()))
+}
+
+func TestWebSeedsLastDiff(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "webseeds.toml")
+	ws := newTestWebSeeds(t, nil)
+
+	require.NoError(os.WriteFile(manifest, []byte(`
+"a.seg" = "https://a.com/a.seg"
+"b.seg" = "https://a.com/b.seg"
+`), 0644))
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+	require.Equal(WebSeedsDiff{Added: []string{"a.seg", "b.seg"}}, ws.LastDiff())
+
+	require.NoError(os.WriteFile(manifest, []byte(`
+"a.seg" = "https://b.com/a.seg"
+"c.seg" = "https://a.com/c.seg"
+`), 0644))
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+	require.Equal(WebSeedsDiff{Added: []string{"c.seg"}, Removed: []string{"b.seg"}, Changed: []string{"a.seg"}}, ws.LastDiff())
+
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+	require.True(ws.LastDiff().Empty())
+}
+
+func testTorrentBytes(t *testing.T, name string) []byte {
+	t.Helper()
+	info := metainfo.Info{Name: name, Length: 1, PieceLength: 256 * 1024, Pieces: make([]byte, 20)}
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, (&metainfo.MetaInfo{InfoBytes: infoBytes}).Write(&buf))
+	return buf.Bytes()
+}
+
+// slowFS - blocks saving until released
+type slowFS struct {
+	osFS
+	started, release chan struct{}
+}
+
+func (fs *slowFS) Rename(oldPath, newPath string) error {
+	close(fs.started)
+	<-fs.release
+	return fs.osFS.Rename(oldPath, newPath)
+}
+
+func TestWebSeedsCancelDuringSave(t *testing.T) {
+	require := require.New(t)
+	torrentBytes := testTorrentBytes(t, "a.seg")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(torrentBytes)
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL + "/a.seg.torrent")
+	require.NoError(err)
+
+	dir := t.TempDir()
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{DownloadTorrentFilesFromWebseed: true})
+	ws.torrentUrls = snaptype.TorrentUrls{"a.seg.torrent": {u}}
+	fs := &slowFS{started: make(chan struct{}), release: make(chan struct{})}
+	ws.torrentFS = fs
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ws.downloadTorrentFilesFromProviders(ctx, dir)
+	}()
+	<-fs.started
+	cancel()
+	select {
+	case <-done:
+		t.Fatal("returned before in-flight save completed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(fs.release)
+	<-done
+
+	got, err := os.ReadFile(filepath.Join(dir, "a.seg.torrent"))
+	require.NoError(err)
+	require.Equal(torrentBytes, got)
+	files, err := os.ReadDir(dir)
+	require.NoError(err)
+	require.Equal(1, len(files))
+}
+
+func TestWebSeedsProviderTimeBudget(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedProviderTimeBudget: downloadercfg.ProviderTimeBudgetEqualSlice})
+	pctx, pcancel := ws.providerCtx(ctx, 4)
+	defer pcancel()
+	deadline, ok := pctx.Deadline()
+	require.True(ok)
+	require.InDelta(time.Second, time.Until(deadline), float64(100*time.Millisecond))
+
+	// hard cap wins over slice
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedProviderTimeBudget: downloadercfg.ProviderTimeBudgetEqualSlice, WebSeedProviderTimeout: 100 * time.Millisecond})
+	pctx, pcancel = ws.providerCtx(ctx, 4)
+	defer pcancel()
+	deadline, _ = pctx.Deadline()
+	require.Less(time.Until(deadline), 200*time.Millisecond)
+
+	// shared: parent deadline
+	ws = newTestWebSeeds(t, nil)
+	pctx, pcancel = ws.providerCtx(ctx, 4)
+	defer pcancel()
+	deadline, _ = pctx.Deadline()
+	parentDeadline, _ := ctx.Deadline()
+	require.Equal(parentDeadline, deadline)
+}
+
+func TestWebSeedsTorrentHeadPreflight(t *testing.T) {
+	require := require.New(t)
+	torrentBytes := testTorrentBytes(t, "a.seg")
+	var gets int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.torrent" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodHead && r.URL.Path == "/nohead.torrent" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Method == http.MethodGet {
+			gets++
+		}
+		_, _ = w.Write(torrentBytes)
+	}))
+	defer srv.Close()
+	base, err := url.Parse(srv.URL)
+	require.NoError(err)
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedTorrentHeadPreflight: true})
+	ctx := context.Background()
+
+	tPath := filepath.Join(t.TempDir(), "a.seg.torrent")
+	_, err = ws.callTorrentHttpProvider(ctx, base.JoinPath("missing.torrent"), tPath)
+	require.Error(err)
+	require.Equal(0, gets)
+
+	res, err := ws.callTorrentHttpProvider(ctx, base.JoinPath("nohead.torrent"), tPath)
+	require.NoError(err)
+	require.NoError(res.commit(tPath))
+	onDisk, err := os.ReadFile(tPath)
+	require.NoError(err)
+	require.Equal(torrentBytes, onDisk)
+	require.Equal(1, gets)
+}
+
+func TestWebSeedsMergeFillGaps(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	primary, backup := filepath.Join(dir, "primary.toml"), filepath.Join(dir, "backup.toml")
+	require.NoError(os.WriteFile(primary, []byte(`"a.seg" = "https://primary.com/a.seg"`), 0644))
+	require.NoError(os.WriteFile(backup, []byte(`
+"a.seg" = "https://backup.com/a.seg"
+"b.seg" = "https://backup.com/b.seg"
+`), 0644))
+
+	ws := newTestWebSeeds(t, nil)
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{primary, backup})
+	urls, _ := ws.ByFileName("a.seg")
+	require.Equal(2, len(urls))
+
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedMergeStrategy: downloadercfg.ManifestMergeFillGaps})
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{primary, backup})
+	urls, _ = ws.ByFileName("a.seg")
+	require.Equal([]string{"https://primary.com/a.seg"}, []string(urls))
+	urls, _ = ws.ByFileName("b.seg")
+	require.Equal([]string{"https://backup.com/b.seg"}, []string(urls))
+}
+
+func TestWebSeedsProviderEntries(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	primary, backup := filepath.Join(dir, "primary.toml"), filepath.Join(dir, "backup.toml")
+	require.NoError(os.WriteFile(primary, []byte(`"a.seg" = "https://primary.com/a.seg"`), 0644))
+	require.NoError(os.WriteFile(backup, []byte(`
+"a.seg" = "https://backup.com/a.seg"
+"a.seg.torrent" = "https://backup.com/a.seg.torrent"
+`), 0644))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`"b.seg" = "https://mirror.com/b.seg"`))
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL + "/webseeds.toml?token=secret")
+	require.NoError(err)
+
+	ws := newTestWebSeeds(t, nil)
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, []*url.URL{u}, []string{primary, backup})
+	require.Equal(map[string]int{primary: 1, backup: 2, srv.URL + "/webseeds.toml?xxxxx": 1}, ws.Stats().ProviderEntries)
+
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedMergeStrategy: downloadercfg.ManifestMergeFillGaps})
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{primary, backup})
+	require.Equal(map[string]int{primary: 1, backup: 1}, ws.Stats().ProviderEntries)
+	require.Equal("s3://erigon-v3-snapshots-mainnet-webseed/mainnet/webseeds.toml",
+		(&WebSeeds{chainName: "mainnet"}).s3ProviderName("v1:"+base64.StdEncoding.EncodeToString([]byte("acc:key:secret"))+":mainnet/webseeds.toml"))
+}
+
+func TestWebSeedsCancelDiscovery(t *testing.T) {
+	require := require.New(t)
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`"a.seg" = "https://a.com/a.seg"`), 0644))
+	ws := newTestWebSeeds(t, nil)
+	ws.Discover(context.Background(), nil, nil, []string{manifest}, t.TempDir())
+	require.Equal(1, ws.Len())
+
+	called := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(called)
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL + "/webseeds.toml")
+	require.NoError(err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ws.Discover(context.Background(), nil, []*url.URL{u}, nil, t.TempDir())
+	}()
+	<-called
+	ws.CancelDiscovery()
+	<-done
+	// half-done run didn't replace result of previous run
+	_, ok := ws.ByFileName("a.seg")
+	require.True(ok)
+
+	ws.CancelDiscovery() // no run - no-op
+}
+
+func TestWebSeedsDiscoverAsync(t *testing.T) {
+	require := require.New(t)
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`"a.seg" = "https://a.com/a.seg"`), 0644))
+	ws := newTestWebSeeds(t, nil)
+	require.NoError(<-ws.DiscoverAsync(context.Background(), nil, nil, []string{manifest}, t.TempDir()))
+	require.Equal(1, ws.Len())
+
+	called := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(called)
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL + "/webseeds.toml")
+	require.NoError(err)
+	done := ws.DiscoverAsync(context.Background(), nil, []*url.URL{u}, nil, t.TempDir())
+	<-called
+	ws.CancelDiscovery()
+	require.ErrorIs(<-done, context.Canceled)
+	_, ok := <-done
+	require.False(ok) // closed
+	require.Equal(1, ws.Len())
+}
+
+func TestWebSeedsTorrentsBySize(t *testing.T) {
+	require := require.New(t)
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`
+"a.seg.torrent" = "https://a.com/a.seg.torrent"
+"b.seg.torrent" = { url = "https://a.com/b.seg.torrent", size = "10kb" }
+"c.seg.torrent" = "https://a.com/c.seg.torrent"
+"c.seg" = { url = "https://a.com/c.seg", size = "1gb" }
+"d.seg.torrent" = { url = "https://a.com/d.seg.torrent", size = 100 }
+`), 0644))
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedTorrentsBySize: true})
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+	require.Equal([]string{"d.seg.torrent", "b.seg.torrent", "c.seg.torrent", "a.seg.torrent"}, ws.torrentsDownloadOrder(ws.TorrentUrls()))
+}
+
+func TestWebSeedsTruncatedResponse(t *testing.T) {
+	require := require.New(t)
+	body := testTorrentBytes(t, "a.seg")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+		_, _ = w.Write(body[:len(body)/2]) // server closes connection: less than declared
+	}))
+	defer srv.Close()
+	ws := newTestWebSeeds(t, nil)
+
+	u, err := url.Parse(srv.URL + "/a.seg.torrent")
+	require.NoError(err)
+	_, err = ws.callTorrentHttpProvider(context.Background(), u, filepath.Join(t.TempDir(), "a.seg.torrent"))
+	require.ErrorIs(err, ErrTruncatedResponse)
+
+	u, err = url.Parse(srv.URL + "/webseeds.toml")
+	require.NoError(err)
+	_, err = ws.callHttpProvider(context.Background(), u)
+	require.ErrorIs(err, ErrTruncatedResponse)
+	require.NotEqual(ProviderErrParse, ProviderErrCategoryOf(err))
+}
+
+func TestWebSeedsRedownloadOnHashChange(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	oldTorrent, newTorrent := testTorrentBytes(t, "a.seg"), testTorrentBytes(t, "a2.seg")
+	newHash, err := torrentInfoHash(newTorrent)
+	require.NoError(err)
+	require.NoError(os.WriteFile(filepath.Join(dir, "a.seg.torrent"), oldTorrent, 0644))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(newTorrent)
+	}))
+	defer srv.Close()
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(fmt.Sprintf(`"a.seg.torrent" = { url = "%s/a.seg.torrent", info_hash = "%s" }`, srv.URL, newHash.HexString())), 0644))
+
+	ws := newTestWebSeeds(t, nil)
+	ws.downloadTorrentFile = true
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+	ws.downloadTorrentFilesFromProviders(context.Background(), dir)
+	onDisk, err := os.ReadFile(filepath.Join(dir, "a.seg.torrent"))
+	require.NoError(err)
+	require.Equal(newTorrent, onDisk)
+}
+
+func TestWebSeedsMissingFiles(t *testing.T) {
+	require := require.New(t)
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`"a.seg" = "https://a.com/a.seg"`), 0644))
+	ws := newTestWebSeeds(t, nil)
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+	require.Equal([]string{"b.seg", "c.seg"}, ws.MissingFiles([]string{"a.seg", "b.seg", "c.seg"}))
+	require.Nil(ws.MissingFiles([]string{"a.seg"}))
+}
+
+func TestWebSeedsForEachFile(t *testing.T) {
+	require := require.New(t)
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`"a.seg" = "https://a.com/a.seg"
+"b.seg" = "https://a.com/b.seg"`), 0644))
+	ws := newTestWebSeeds(t, nil)
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+
+	seen := map[string]metainfo.UrlList{}
+	ws.ForEachFile(func(name string, urls metainfo.UrlList) bool {
+		_, _ = ws.ByFileName(name) // no deadlock
+		seen[name] = urls
+		return true
+	})
+	require.Equal(map[string]metainfo.UrlList{"a.seg": {"https://a.com/a.seg"}, "b.seg": {"https://a.com/b.seg"}}, seen)
+
+	var calls int
+	ws.ForEachFile(func(string, metainfo.UrlList) bool {
+		calls++
+		return false
+	})
+	require.Equal(1, calls)
+}
+
+func TestWebSeedsFileClassifier(t *testing.T) {
+	require := require.New(t)
+	require.Equal(snaptype.FileClass{Category: "headers", Ext: ".seg"}, snaptype.DefaultFileClassifier.Classify("v1-000000-000500-headers.seg.torrent"))
+	require.Equal(snaptype.FileClass{Category: "commitment", Ext: ".ef"}, snaptype.DefaultFileClassifier.Classify("history/commitment.0-32.ef"))
+	require.Equal(snaptype.FileClass{}, snaptype.DefaultFileClassifier.Classify("README"))
+
+	// new naming: known only by custom classifier, both files filter and skip rule follow it
+	classifier := snaptype.FileClassifierFunc(func(name string) snaptype.FileClass {
+		if strings.HasPrefix(filepath.Base(name), "trie-") {
+			return snaptype.FileClass{Category: "commitment", Ext: ".v"}
+		}
+		return snaptype.DefaultFileClassifier.Classify(name)
+	})
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedFileClassifier: classifier, WebSeedFilesFilter: []string{"commitment"}})
+	require.True(ws.matchFilesFilter("trie-0-32.dat"))
+	require.True(ws.matchFilesFilter("commitment.0-32.kv"))
+	require.False(ws.matchFilesFilter("accounts.0-32.kv"))
+	require.True(ws.skipTorrent("trie-0-32.dat.torrent"))
+	require.False(ws.skipTorrent("trie-0-32.dat")) // only .torrent files are skipped
+	require.False(SkipUnsupportedTorrent("trie-0-32.dat.torrent"))
+}
+
+func TestWebSeedsMerge(t *testing.T) {
+	require := require.New(t)
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`"a.seg" = "https://a.com/a.seg"
+"a.seg.torrent" = "https://a.com/a.seg.torrent"`), 0644))
+	ws := newTestWebSeeds(t, nil)
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+	before := ws.TorrentUrls()
+
+	mirrorTorrent, err := url.Parse("https://b.com/a.seg.torrent")
+	require.NoError(err)
+	knownTorrent, err := url.Parse("https://a.com/a.seg.torrent")
+	require.NoError(err)
+	ws.Merge(snaptype.WebSeedUrls{"a.seg": {"https://a.com/a.seg", "https://b.com/a.seg"}, "b.seg": {"https://b.com/b.seg"}},
+		snaptype.TorrentUrls{"a.seg.torrent": {knownTorrent, mirrorTorrent}})
+
+	urls, ok := ws.ByFileName("a.seg")
+	require.True(ok)
+	require.Equal(metainfo.UrlList{"https://a.com/a.seg", "https://b.com/a.seg"}, urls)
+	urls, ok = ws.ByFileName("b.seg")
+	require.True(ok)
+	require.Equal(metainfo.UrlList{"https://b.com/b.seg"}, urls)
+	require.Equal(2, len(ws.TorrentUrls()["a.seg.torrent"]))
+	require.Equal(1, len(before["a.seg.torrent"])) // snapshot not changed
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestWebSeedsReconcile(t *testing.T) {
+	require := require.New(t)
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(`"a.seg" = "https://a.com/a.seg"
+"a.seg.torrent" = "https://a.com/a.seg.torrent"
+"b.seg.torrent" = "https://a.com/b.seg.torrent"
+"c.seg" = "https://a.com/c.seg"`), 0644))
+	ws := newTestWebSeeds(t, nil)
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+
+	require.True(ws.Reconcile([]string{"a.seg", "b.seg.torrent", "c.seg"}).Empty())
+	r := ws.Reconcile([]string{"a.seg", "a.seg.torrent", "d.seg", "e.seg"})
+	require.Equal(WebSeedsReconcile{NotInClient: []string{"b.seg", "c.seg"}, NotDiscovered: []string{"d.seg", "e.seg"}}, r)
+}
+
+func TestWebSeedsReadFilesParallel(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 3*diskProvidersReadWorkers; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("webseeds%d.toml", i))
+		content := fmt.Sprintf(`"%d.seg" = "https://a.com/%d.seg"`, i, i)
+		if i%5 == 0 {
+			content = "broken"
+		}
+		require.NoError(os.WriteFile(path, []byte(content), 0644))
+		paths = append(paths, path)
+	}
+	paths = append(paths, filepath.Join(dir, "not-exists.toml"))
+
+	ws := newTestWebSeeds(t, nil)
+	responses, errs := ws.readWebSeedsFiles(paths)
+	require.Equal(len(paths), len(responses))
+	for i := range paths {
+		if i%5 == 0 || i == len(paths)-1 {
+			require.Error(errs[i], i)
+			continue
+		}
+		require.NoError(errs[i])
+		require.Equal(fmt.Sprintf("https://a.com/%d.seg", i), responses[i].files[fmt.Sprintf("%d.seg", i)], i)
+	}
+}
+
+func TestWebSeedsTorrentSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on windows")
+	}
+	require := require.New(t)
+	dir, outside := t.TempDir(), t.TempDir()
+	require.NoError(os.Symlink(outside, filepath.Join(dir, "escape")))
+	require.NoError(os.Mkdir(filepath.Join(outside, "inner"), 0755))
+	require.NoError(os.Symlink(filepath.Join(outside, "b.seg.torrent"), filepath.Join(dir, "b.seg.torrent")))
+	root := filepath.Join(t.TempDir(), "root") // root itself may be symlink
+	require.NoError(os.Symlink(dir, root))
+
+	_, err := safeTorrentPath(root, "../a.seg.torrent")
+	require.Error(err)
+	_, err = safeTorrentPath(root, "escape/inner/a.seg.torrent")
+	require.Error(err)
+	_, err = safeTorrentPath(root, "b.seg.torrent")
+	require.Error(err)
+	tPath, err := safeTorrentPath(root, "a.seg.torrent")
+	require.NoError(err)
+	require.Equal(filepath.Join(root, "a.seg.torrent"), tPath)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testTorrentBytes(t, strings.TrimSuffix(filepath.Base(r.URL.Path), ".torrent")))
+	}))
+	defer srv.Close()
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(fmt.Sprintf(`
+"escape/c.seg.torrent" = "%s/c.seg.torrent"
+"d.seg.torrent" = "%s/d.seg.torrent"
+`, srv.URL, srv.URL)), 0644))
+	ws := newTestWebSeeds(t, nil)
+	ws.downloadTorrentFile = true
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+	ws.downloadTorrentFilesFromProviders(context.Background(), root)
+	require.NoFileExists(filepath.Join(outside, "c.seg.torrent"))
+	require.FileExists(filepath.Join(dir, "d.seg.torrent"))
+}
+
+// BenchmarkWebSeedsMergeManifests - large catalog listed by several mirrors.
+// Compare `go test -run=none -bench=MergeManifests -benchmem`: maps pre-sized by biggest manifest vs growing from empty
+func BenchmarkWebSeedsMergeManifests(b *testing.B) {
+	const providers, files = 3, 100_000
+	list := make([]*webSeedManifest, providers)
+	for p := range list {
+		list[p] = &webSeedManifest{files: make(snaptype.WebSeedsFromProvider, files), provider: fmt.Sprintf("https://mirror%d.example.com", p)}
+		for i := 0; i < files; i++ {
+			name := fmt.Sprintf("v1-%06d-%06d-headers.seg", i, i+1)
+			list[p].files[name] = fmt.Sprintf("https://mirror%d.example.com/%s", p, name)
+			if i%10 == 0 {
+				list[p].files[name+".torrent"] = fmt.Sprintf("https://mirror%d.example.com/%s.torrent", p, name)
+			}
+		}
+	}
+	ws, err := NewWebSeeds(&downloadercfg.Cfg{}, log.New(), log.LvlInfo)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bc := range []struct {
+		name    string
+		presize bool
+	}{{"growing", false}, {"presized", true}} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				m := newMergedManifests(nil)
+				if bc.presize {
+					m = newMergedManifests(list)
+				}
+				ws.mergeManifests(m, list)
+			}
+		})
+	}
+}
+
+func TestWebSeedsByFileNameWithSource(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.toml"), filepath.Join(dir, "second.toml")
+	require.NoError(os.WriteFile(first, []byte(`"a.seg" = "https://one.example.com/a.seg"`), 0644))
+	require.NoError(os.WriteFile(second, []byte(`
+"a.seg" = "https://two.example.com/a.seg"
+"b.seg" = "https://two.example.com/b.seg"
+`), 0644))
+	ws := newTestWebSeeds(t, nil)
+	ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{first, second})
+	ws.Merge(snaptype.WebSeedUrls{"a.seg": {"https://three.example.com/a.seg"}}, nil)
+
+	res, ok := ws.ByFileNameWithSource("a.seg")
+	require.True(ok)
+	require.Equal([]WebSeedUrl{
+		{Url: "https://one.example.com/a.seg", Provider: first},
+		{Url: "https://two.example.com/a.seg", Provider: second},
+		{Url: "https://three.example.com/a.seg"},
+	}, res)
+	urls, _ := ws.ByFileName("a.seg")
+	require.Len(urls, len(res))
+
+	res, ok = ws.ByFileNameWithSource("b.seg")
+	require.True(ok)
+	require.Equal([]WebSeedUrl{{Url: "https://two.example.com/b.seg", Provider: second}}, res)
+	_, ok = ws.ByFileNameWithSource("c.seg")
+	require.False(ok)
+}
+
+func TestWebSeedsMaxEntries(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	manifest := func(name string, entries int) string {
+		var lines []string
+		for i := 0; i < entries; i++ {
+			lines = append(lines, fmt.Sprintf(`"%s-%d.seg" = "https://example.com/%s-%d.seg"`, name, i, name, i))
+		}
+		path := filepath.Join(dir, name+".toml")
+		require.NoError(os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644))
+		return path
+	}
+	small, medium, big := manifest("small", 2), manifest("medium", 4), manifest("big", 10)
+	for _, c := range []struct {
+		perManifest, total int
+		expected           int
+	}{
+		{0, 0, 16},   // defaults
+		{-1, -1, 16}, // no limits
+		{5, 0, 6},    // big ignored
+		{0, 12, 12},  // medium doesn't fit after big, small does
+		{0, 1, 0},    // none fits
+		{4, 6, 6},    // both limits
+		{10, 10, 10}, // limits are inclusive: big fits alone
+	} {
+		ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedMaxManifestEntries: c.perManifest, WebSeedMaxTotalEntries: c.total, WebSeedDisableFallback: true})
+		ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{big, medium, small})
+		require.Equal(c.expected, ws.Len(), "%d/%d", c.perManifest, c.total)
+	}
+}
+
+func TestWebSeedsTorrentsMaxDuration(t *testing.T) {
+	require := require.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write(testTorrentBytes(t, strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ".torrent")))
+	}))
+	defer srv.Close()
+	var lines []string
+	for i := 0; i < 3*orderedTorrentDownloadWorkers; i++ {
+		lines = append(lines, fmt.Sprintf(`"%d.seg.torrent" = "%s/%d.seg.torrent"`, i, srv.URL, i))
+	}
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(strings.Join(lines, "\n")), 0644))
+
+	download := func(maxDuration time.Duration) int {
+		dir := t.TempDir()
+		ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedTorrentsMaxDuration: maxDuration, WebSeedTorrentsBySize: true})
+		ws.downloadTorrentFile = true
+		ws.downloadWebseedTomlFromProviders(context.Background(), nil, nil, []string{manifest})
+		ws.downloadTorrentFilesFromProviders(context.Background(), dir)
+		entries, err := os.ReadDir(dir)
+		require.NoError(err)
+		return len(entries)
+	}
+	require.Equal(len(lines), download(0))
+	start := time.Now()
+	downloaded := download(100 * time.Millisecond) // 1st batch of workers started, rest not
+	require.Equal(orderedTorrentDownloadWorkers, downloaded)
+	require.Less(time.Since(start), 2*time.Second)
+}
+
+func TestWebSeedsMinSuccessfulProviders(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+	a := write("a.toml", `"a.seg" = "https://a.example.com/a.seg"`)
+	b := write("b.toml", `"b.seg" = "https://b.example.com/b.seg"`)
+	bad := write("bad.toml", `not toml =`)
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedMinSuccessfulProviders: 2, WebSeedDisableFallback: true})
+	require.NoError(ws.discover(context.Background(), &webSeedProviders{files: []string{a, b}}, dir))
+	require.Equal(2, ws.Len())
+
+	err := <-ws.DiscoverAsync(context.Background(), nil, nil, []string{a, bad}, dir)
+	require.ErrorIs(err, ErrNotEnoughProviders)
+	require.Equal(2, ws.Len()) // previous result kept
+	_, ok := ws.ByFileName("b.seg")
+	require.True(ok)
+
+	// default: 1
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedDisableFallback: true})
+	require.NoError(ws.discover(context.Background(), &webSeedProviders{files: []string{a, bad}}, dir))
+	require.Equal(1, ws.Len())
+	require.ErrorIs(ws.discover(context.Background(), &webSeedProviders{files: []string{bad}}, dir), ErrNotEnoughProviders)
+	require.Equal(1, ws.Len())
+
+	// no providers configured: nothing to require, empty result without warning
+	var warnings atomic.Int32
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedDisableFallback: true})
+	ws.logger.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		if r.Lvl <= log.LvlWarn {
+			warnings.Add(1)
+		}
+		return nil
+	}))
+	require.NoError(ws.discover(context.Background(), &webSeedProviders{}, dir))
+	require.NoError(ws.DiscoverConfigured(context.Background(), dir))
+	require.Equal(0, ws.Len())
+	require.Equal(int32(0), warnings.Load())
+}
+
+// failRenameFS - first `fails` saves fail
+type failRenameFS struct {
+	osFS
+	fails atomic.Int32
+}
+
+func (fs *failRenameFS) Rename(oldPath, newPath string) error {
+	if fs.fails.Add(-1) >= 0 {
+		return errors.New("disk error")
+	}
+	return fs.osFS.Rename(oldPath, newPath)
+}
+
+func TestWebSeedsTorrentConsistency(t *testing.T) {
+	require := require.New(t)
+	var lock sync.Mutex
+	requests := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests[r.URL.Path]++
+		lock.Unlock()
+		name := strings.TrimSuffix(filepath.Base(r.URL.Path), ".torrent")
+		if strings.HasPrefix(r.URL.Path, "/stale/") { // same name, other content
+			name += "-stale"
+		}
+		_, _ = w.Write(testTorrentBytes(t, name))
+	}))
+	defer srv.Close()
+	urls := func(paths ...string) []*url.URL {
+		var res []*url.URL
+		for _, p := range paths {
+			u, err := url.Parse(srv.URL + p)
+			require.NoError(err)
+			res = append(res, u)
+		}
+		return res
+	}
+
+	dir := t.TempDir()
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{DownloadTorrentFilesFromWebseed: true, WebSeedTorrentConsistencySample: 1})
+	ws.torrentUrls = snaptype.TorrentUrls{
+		"a.seg.torrent": urls("/a/a.seg.torrent", "/b/a.seg.torrent"),
+		"c.seg.torrent": urls("/a/c.seg.torrent", "/stale/c.seg.torrent"),
+	}
+	ws.downloadTorrentFilesFromProviders(context.Background(), dir)
+	require.FileExists(filepath.Join(dir, "a.seg.torrent"))   // consistent
+	require.NoFileExists(filepath.Join(dir, "c.seg.torrent")) // inconsistent
+	require.Equal(map[string]int{"/a/a.seg.torrent": 1, "/b/a.seg.torrent": 1, "/a/c.seg.torrent": 1, "/stale/c.seg.torrent": 1}, requests)
+
+	// save failed: copy of next url is saved
+	requests = map[string]int{}
+	dir = t.TempDir()
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{DownloadTorrentFilesFromWebseed: true})
+	fs := &failRenameFS{}
+	fs.fails.Store(1)
+	ws.torrentFS = fs
+	ws.torrentUrls = snaptype.TorrentUrls{"a.seg.torrent": urls("/a/a.seg.torrent", "/b/a.seg.torrent", "/c/a.seg.torrent")}
+	ws.downloadTorrentFilesFromProviders(context.Background(), dir)
+	require.FileExists(filepath.Join(dir, "a.seg.torrent"))
+	require.Equal(map[string]int{"/a/a.seg.torrent": 1, "/b/a.seg.torrent": 1}, requests)
+
+	// all saves failed
+	requests = map[string]int{}
+	dir = t.TempDir()
+	fs.fails.Store(3)
+	ws.downloadTorrentFilesFromProviders(context.Background(), dir)
+	require.NoFileExists(filepath.Join(dir, "a.seg.torrent"))
+	require.Equal(map[string]int{"/a/a.seg.torrent": 1, "/b/a.seg.torrent": 1, "/c/a.seg.torrent": 1}, requests)
+}
+
+func TestWebSeedsShouldDownload(t *testing.T) {
+	require := require.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testTorrentBytes(t, strings.TrimSuffix(filepath.Base(r.URL.Path), ".torrent")))
+	}))
+	defer srv.Close()
+	manifest := filepath.Join(t.TempDir(), "webseeds.toml")
+	require.NoError(os.WriteFile(manifest, []byte(fmt.Sprintf(`
+"a.seg.torrent" = "%[1]s/a.seg.torrent"
+"b.seg.torrent" = "%[1]s/b.seg.torrent"
+`, srv.URL)), 0644))
+
+	dir := t.TempDir()
+	var lock sync.Mutex
+	asked := map[string]string{} // name -> name of info
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{DownloadTorrentFilesFromWebseed: true, WebSeedShouldDownload: func(name string, mi *metainfo.MetaInfo) bool {
+		info, err := mi.UnmarshalInfo()
+		require.NoError(err)
+		lock.Lock()
+		defer lock.Unlock()
+		asked[name] = info.Name
+		return name != "b.seg.torrent"
+	}})
+	ws.Discover(context.Background(), nil, nil, []string{manifest}, dir)
+	require.Equal(map[string]string{"a.seg.torrent": "a.seg", "b.seg.torrent": "b.seg"}, asked)
+	require.FileExists(filepath.Join(dir, "a.seg.torrent"))
+	require.NoFileExists(filepath.Join(dir, "b.seg.torrent"))
+	require.Contains(ws.skipped, "b.seg.torrent\x00"+string(SkipNotApproved))
+}
+
+func TestWebSeedsUserAgent(t *testing.T) {
+	require := require.New(t)
+	require.Equal("erigon/2.53.0-dev-a68ea6e2 (chain=mainnet)", downloadercfg.DefaultWebSeedUserAgent("erigon: 2.53.0-dev-a68ea6e2", "mainnet"))
+	require.Equal("erigon", downloadercfg.DefaultWebSeedUserAgent("", ""))
+
+	torrentBytes := testTorrentBytes(t, "a.seg")
+	var lock sync.Mutex
+	agents := map[string]string{} // path -> User-Agent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		agents[r.URL.Path] = r.Header.Get("User-Agent")
+		lock.Unlock()
+		if r.URL.Path == "/a.seg.torrent" {
+			_, _ = w.Write(torrentBytes)
+			return
+		}
+		_, _ = w.Write([]byte(`"a.seg" = "https://a.com/a.seg"`))
+	}))
+	defer srv.Close()
+	base, err := url.Parse(srv.URL)
+	require.NoError(err)
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	ua := downloadercfg.DefaultWebSeedUserAgent("erigon: 2.53.0", "mainnet")
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{ChainName: "mainnet", WebSeedUserAgent: ua})
+	ctx := context.Background()
+	_, err = ws.callHttpProvider(ctx, base.JoinPath("webseeds.toml"))
+	require.NoError(err)
+	_, err = ws.callTorrentHttpProvider(ctx, base.JoinPath("a.seg.torrent"), filepath.Join(t.TempDir(), "a.seg.torrent"))
+	require.NoError(err)
+	_, err = ws.callS3Provider(ctx, "s3://bucket/s3.toml?region=us-east-1&endpoint="+srv.URL)
+	require.NoError(err)
+
+	require.Equal(ua, agents["/webseeds.toml"])
+	require.Equal(ua, agents["/a.seg.torrent"])
+	require.Contains(agents["/bucket/s3.toml"], "erigon-2.53.0--chain-mainnet-") // aws sdk sanitizes key and appends it to own user-agent
+}
+
+func TestWebSeedsByFileNameBalanced(t *testing.T) {
+	require := require.New(t)
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedHostWeights: map[string]float64{"a.com": 3, "c.com": 0}})
+	urls := []string{"https://c.com/a.seg", "https://b.com/a.seg", "https://a.com/a.seg"}
+	ws.Merge(snaptype.WebSeedUrls{"a.seg": urls}, nil)
+
+	_, ok := ws.ByFileNameBalanced("missing.seg")
+	require.False(ok)
+	first := map[string]int{}
+	const n = 2000
+	for i := 0; i < n; i++ {
+		balanced, ok := ws.ByFileNameBalanced("a.seg")
+		require.True(ok)
+		require.ElementsMatch(urls, []string(balanced))
+		require.Equal("https://c.com/a.seg", balanced[2]) // zero weight - always last
+		first[balanced[0]]++
+	}
+	require.InDelta(0.75, float64(first["https://a.com/a.seg"])/n, 0.07) // 3/(3+1)
+	require.InDelta(0.25, float64(first["https://b.com/a.seg"])/n, 0.07)
+
+	ordered, _ := ws.ByFileName("a.seg")
+	require.Equal(urls, []string(ordered)) // not changed by balancing
+}
@@ -0,0 +1,115 @@
+package downloader
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// downloadedTorrent - .torrent file streamed to temp file in staging dir, validated (decoded) while streaming:
+// whole file is not held in memory, with many concurrent downloads of big .torrent files it matters.
+// Must be committed or discarded
+type downloadedTorrent struct {
+	fs      torrentFS
+	tmpPath string
+	hash    metainfo.Hash
+	mi      *metainfo.MetaInfo // decoded while streaming
+}
+
+// streamTorrent - writes body to temp file in `dir` while decoding it. Body bigger than maxTorrentFileSize is error
+func streamTorrent(fs torrentFS, dir, name string, body io.Reader) (_ *downloadedTorrent, err error) {
+	f, err := fs.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	res := &downloadedTorrent{fs: fs, tmpPath: f.Name()}
+	defer func() {
+		if err != nil {
+			f.Close()
+			res.discard()
+		}
+	}()
+	limited := &io.LimitedReader{R: body, N: int64(maxTorrentFileSize) + 1}
+	w := bufio.NewWriter(f)
+	tee := &readErrRecorder{r: io.TeeReader(limited, w)}
+	res.mi = &metainfo.MetaInfo{}
+	if err = bencode.NewDecoder(tee).Decode(res.mi); err != nil { // InfoBytes is raw info dict: info-hash is of exactly these bytes
+		if tee.err != nil { // decoder doesn't wrap errors of reader: keep ErrTruncatedResponse, etc. visible to errors.Is
+			return nil, tee.err
+		}
+		return nil, err
+	}
+	if len(res.mi.InfoBytes) == 0 || res.mi.InfoBytes[0] != 'd' {
+		return nil, fmt.Errorf("no info dict")
+	}
+	res.hash = res.mi.HashInfoBytes()
+	if _, err = io.Copy(io.Discard, tee); err != nil { // rest of body (if any) is also part of file
+		return nil, err
+	}
+	if limited.N == 0 {
+		return nil, fmt.Errorf("bigger than %s", maxTorrentFileSize.HR())
+	}
+	if err = w.Flush(); err != nil {
+		return nil, err
+	}
+	if err = f.Sync(); err != nil {
+		return nil, err
+	}
+	if err = f.Close(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// readErrRecorder - first not-EOF error of underlying reader
+type readErrRecorder struct {
+	r   io.Reader
+	err error
+}
+
+func (r *readErrRecorder) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+// commit - atomic, see saveTorrentFS. Must be on same file system as temp file (staging dir is in rootDir)
+func (t *downloadedTorrent) commit(torrentFilePath string) error {
+	if err := t.fs.Rename(t.tmpPath, torrentFilePath); err != nil {
+		return err
+	}
+	return t.fs.SyncDir(filepath.Dir(torrentFilePath))
+}
+
+// discard - no-op after commit
+func (t *downloadedTorrent) discard() {
+	_ = t.fs.Remove(t.tmpPath)
+}
+
+// torrentsStagingDir - in rootDir (same file system: promotion is rename). .torrent files are downloaded and validated there,
+// so torrent client scanning rootDir never sees in-progress or not validated files
+const torrentsStagingDir = ".webseed-staging"
+
+// prepareTorrentsStaging - leftovers (of crash or kill) are removed: runs are serialized, so nothing in it is in use
+func prepareTorrentsStaging(rootDir string) (string, error) {
+	if err := removeTorrentsStaging(rootDir); err != nil {
+		return "", err
+	}
+	stagingDir := filepath.Join(rootDir, torrentsStagingDir)
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		return "", err
+	}
+	return stagingDir, nil
+}
+
+// removeTorrentsStaging - also called once on start (see NewWebSeeds): run without .torrent files to download doesn't touch staging
+func removeTorrentsStaging(rootDir string) error {
+	return os.RemoveAll(filepath.Join(rootDir, torrentsStagingDir))
+}
@@ -0,0 +1,122 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ledgerwatch/erigon-lib/common/datadir"
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/ledgerwatch/erigon-lib/downloader/snaptype"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsStreamTorrent(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	torrentBytes := testTorrentBytes(t, "a.seg")
+	expected, err := torrentInfoHash(torrentBytes)
+	require.NoError(err)
+
+	_, err = streamTorrent(osFS{}, dir, "a.seg.torrent", bytes.NewReader(torrentBytes[:len(torrentBytes)/2]))
+	require.Error(err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(err)
+	require.Equal(0, len(entries)) // temp file removed
+
+	body := append(append([]byte{}, torrentBytes...), "trailing"...) // kept as is, like before streaming
+	res, err := streamTorrent(osFS{}, dir, "a.seg.torrent", bytes.NewReader(body))
+	require.NoError(err)
+	require.Equal(expected, res.hash)
+	mi := res.mi
+	full, err := metainfo.Load(bytes.NewReader(torrentBytes))
+	require.NoError(err)
+	require.Equal(full.Announce, mi.Announce)
+	require.Equal(full.UrlList, mi.UrlList)
+	fullInfo, err := full.UnmarshalInfo()
+	require.NoError(err)
+	info, err := mi.UnmarshalInfo()
+	require.NoError(err)
+	require.Equal(fullInfo.Name, info.Name)
+	require.Equal(fullInfo.Length, info.Length)
+	require.Equal(fullInfo.Pieces, info.Pieces)
+	require.Equal([]byte(full.InfoBytes), []byte(mi.InfoBytes))
+	tPath := filepath.Join(dir, "a.seg.torrent")
+	require.NoError(res.commit(tPath))
+	res.discard() // after commit - no-op
+	onDisk, err := os.ReadFile(tPath)
+	require.NoError(err)
+	require.Equal(body, onDisk)
+	entries, err = os.ReadDir(dir)
+	require.NoError(err)
+	require.Equal(1, len(entries))
+
+	for _, invalid := range []string{"", "le", "d8:announce3:abce", "d4:infoi1ee", "d4:info" + strings.Repeat("l", 100) + "e", "d4:info99:abce"} {
+		_, err = streamTorrent(osFS{}, dir, "b.seg.torrent", strings.NewReader(invalid))
+		require.Error(err, invalid)
+	}
+	_, err = streamTorrent(osFS{}, dir, "b.seg.torrent", iotest.ErrReader(ErrTruncatedResponse))
+	require.ErrorIs(err, ErrTruncatedResponse)
+	entries, err = os.ReadDir(dir)
+	require.NoError(err)
+	require.Equal(1, len(entries))
+}
+
+func TestWebSeedsTorrentsStaging(t *testing.T) {
+	require := require.New(t)
+	torrentBytes := testTorrentBytes(t, "a.seg")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(torrentBytes)
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL + "/a.seg.torrent")
+	require.NoError(err)
+
+	dir := t.TempDir()
+	staging := filepath.Join(dir, torrentsStagingDir)
+	require.NoError(os.MkdirAll(staging, 0755))
+	require.NoError(os.WriteFile(filepath.Join(staging, "b.seg.torrent.123.tmp"), []byte("leftover of crash"), 0644))
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{DownloadTorrentFilesFromWebseed: true})
+	ws.torrentUrls = snaptype.TorrentUrls{"a.seg.torrent": {u}}
+	fs := &slowFS{started: make(chan struct{}), release: make(chan struct{})}
+	ws.torrentFS = fs
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ws.downloadTorrentFilesFromProviders(context.Background(), dir)
+	}()
+	<-fs.started // downloaded and validated, not promoted yet: only in staging
+	entries, err := os.ReadDir(dir)
+	require.NoError(err)
+	require.Len(entries, 1)
+	require.Equal(torrentsStagingDir, entries[0].Name())
+	staged, err := os.ReadDir(staging)
+	require.NoError(err)
+	require.Len(staged, 1)
+	require.True(strings.HasPrefix(staged[0].Name(), "a.seg.torrent."))
+	close(fs.release)
+	<-done
+
+	got, err := os.ReadFile(filepath.Join(dir, "a.seg.torrent"))
+	require.NoError(err)
+	require.Equal(torrentBytes, got)
+	entries, err = os.ReadDir(dir)
+	require.NoError(err)
+	require.Len(entries, 1) // staging removed
+
+	// leftovers removed on start, even if no run has .torrent files to download
+	require.NoError(os.MkdirAll(staging, 0755))
+	require.NoError(os.WriteFile(filepath.Join(staging, "b.seg.torrent.123.tmp"), []byte("leftover of crash"), 0644))
+	newTestWebSeeds(t, &downloadercfg.Cfg{Dirs: datadir.Dirs{Snap: dir}, DownloadTorrentFilesFromWebseed: true})
+	require.NoDirExists(staging)
+	require.FileExists(filepath.Join(dir, "a.seg.torrent"))
+}
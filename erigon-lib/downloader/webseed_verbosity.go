@@ -0,0 +1,38 @@
+package downloader
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/ledgerwatch/log/v3"
+)
+
+// newProviderVerbosity - keys normalized same way as hosts of requests (see url.Hostname): lowercase, IPv6 without brackets
+func newProviderVerbosity(cfg map[string]log.Lvl) map[string]log.Lvl {
+	if len(cfg) == 0 {
+		return nil
+	}
+	res := make(map[string]log.Lvl, len(cfg))
+	for host, lvl := range cfg {
+		res[strings.ToLower(strings.Trim(host, "[]"))] = lvl
+	}
+	return res
+}
+
+// requestVerbosity - level of detailed logs (trace of requests, retries, errors) of host of `u`.
+// `detailed` - host has override (see WebSeedProviderVerbosity) or WebSeedTrace enabled
+func (d *WebSeeds) requestVerbosity(u *url.URL) (lvl log.Lvl, detailed bool) {
+	if lvl, ok := d.providerVerbosity[strings.ToLower(u.Hostname())]; ok {
+		return lvl, true
+	}
+	return d.verbosity, d.trace
+}
+
+// logRequest - debug log line about request to provider, at level of its override if it has one. Disk providers have no host: always debug
+func (d *WebSeeds) logRequest(u *url.URL, msg string, ctx ...interface{}) {
+	if lvl, ok := d.providerVerbosity[strings.ToLower(u.Hostname())]; ok {
+		d.logger.Log(lvl, msg, ctx...)
+		return
+	}
+	d.logger.Debug(msg, ctx...)
+}
@@ -0,0 +1,84 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsProviderVerbosity(t *testing.T) {
+	require := require.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(err)
+
+	var lock sync.Mutex
+	records := map[string][]log.Lvl{} // host -> levels
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedProviderVerbosity: map[string]log.Lvl{"LOCALHOST": log.LvlInfo}, WebSeedRetries: 1})
+	ws.retryBackoff = time.Millisecond
+	ws.logger.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			if r.Ctx[i] == "url" {
+				if u, err := url.Parse(fmt.Sprint(r.Ctx[i+1])); err == nil {
+					lock.Lock()
+					records[u.Hostname()] = append(records[u.Hostname()], r.Lvl)
+					lock.Unlock()
+				}
+			}
+		}
+		return nil
+	}))
+	for _, host := range []string{"localhost", "127.0.0.1"} {
+		u, err := url.Parse("http://" + net.JoinHostPort(host, port) + "/webseeds.toml")
+		require.NoError(err)
+		_, err = ws.callHttpProviderPage(context.Background(), u)
+		require.Error(err)
+	}
+	// localhost: trace, retry, trace. Other hosts: retry only, at debug
+	require.Equal(map[string][]log.Lvl{"localhost": {log.LvlInfo, log.LvlInfo, log.LvlInfo}, "127.0.0.1": {log.LvlDebug}}, records)
+
+	lvl, detailed := ws.requestVerbosity(&url.URL{Host: "[::1]:8080"})
+	require.False(detailed)
+	require.Equal(ws.verbosity, lvl)
+	require.Equal("info", ws.Config()["provider_verbosity"].(map[string]string)["localhost"])
+
+	// errors of s3 providers - by host of endpoint, of disk providers - debug
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_CA_BUNDLE", "")
+	t.Setenv("AWS_MAX_ATTEMPTS", "1") // 503 of test server is retried by aws sdk with backoff
+	failed := map[string]log.Lvl{}    // s3 provider or file -> level
+	ws.logger.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		if r.Msg != "[snapshots] downloadWebseedTomlFromProviders" {
+			return nil
+		}
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			if r.Ctx[i] == "provider" || r.Ctx[i] == "file" {
+				failed[fmt.Sprint(r.Ctx[i+1])] = r.Lvl
+			}
+		}
+		return nil
+	}))
+	tokens := []string{
+		"s3://a/webseeds.toml?region=us-east-1&endpoint=http://" + net.JoinHostPort("localhost", port),
+		"s3://b/webseeds.toml?region=us-east-1&endpoint=http://" + net.JoinHostPort("127.0.0.1", port),
+	}
+	_, err = ws.fetchManifests(context.Background(), tokens, nil, []string{filepath.Join(t.TempDir(), "missing.toml")})
+	require.Error(err)
+	require.Equal(map[string]log.Lvl{"s3://a/webseeds.toml": log.LvlInfo, "s3://b/webseeds.toml": log.LvlDebug, "missing.toml": log.LvlDebug}, failed)
+}
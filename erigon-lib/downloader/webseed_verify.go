@@ -0,0 +1,136 @@
+package downloader
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// verifyHeadWorkers - parallel HEAD requests of Verify
+const verifyHeadWorkers = 16
+
+// VerifyProviderResult - Err is nil if provider returned valid manifest
+type VerifyProviderResult struct {
+	Provider string // redacted url, s3 bucket/key, file path or "fallback"
+	Entries  int    // of its manifest
+	Err      error
+}
+
+// VerifyUrlResult - HEAD of 1 .torrent url. Err is nil if url exists (or host doesn't support HEAD: not known)
+type VerifyUrlResult struct {
+	Name string
+	Url  string // redacted
+	Err  error
+}
+
+// VerifyReport - result of WebSeeds.Verify
+type VerifyReport struct {
+	Providers   []VerifyProviderResult
+	Files       int // data files of merged manifests
+	Torrents    int // .torrent files of merged manifests
+	TorrentUrls []VerifyUrlResult
+	Err         error // cancelled or ErrNotEnoughProviders: urls not checked
+}
+
+func (r *VerifyReport) Ok() bool {
+	if r.Err != nil {
+		return false
+	}
+	for _, p := range r.Providers {
+		if p.Err != nil {
+			return false
+		}
+	}
+	for _, u := range r.TorrentUrls {
+		if u.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify - "verify only" discovery, for validation pipelines (CI against production mirrors): fetches and validates
+// manifests the same way as Discover, merges them and checks by HEAD that each .torrent url exists. Nothing is published
+// and nothing is written to disk: discovered files and .torrent files of node stay as they are.
+// Only observability is updated: Stats (latency of this run too), RecentErrors (of providers), weights of hosts.
+// Bytes are not counted into byte budget of Discover runs.
+// Unlike SelfTest (1 .torrent per provider, downloaded), checks all urls of merged result. Serialized with Discover runs
+func (d *WebSeeds) Verify(ctx context.Context, s3tokens []string, urls []*url.URL, files []string) *VerifyReport {
+	d.discoveryLock.Lock()
+	defer d.discoveryLock.Unlock()
+	res := &VerifyReport{}
+	if err := d.waitResumed(ctx); err != nil {
+		res.Err = err
+		return res
+	}
+	ctx = withAccounting(ctx, accountObservability)
+	defer d.finishLatency()
+
+	fetched, err := d.fetchManifests(ctx, s3tokens, urls, files)
+	entries := make(map[string]int, len(fetched.list))
+	for _, manifest := range fetched.list {
+		entries[manifest.provider] = len(manifest.files)
+	}
+	for _, provider := range fetched.providers {
+		p := VerifyProviderResult{Provider: provider, Entries: entries[provider], Err: fetched.failed[provider]}
+		if _, ok := entries[provider]; !ok && p.Err == nil {
+			p.Err = ErrManifestRejected
+		}
+		delete(entries, provider)
+		res.Providers = append(res.Providers, p)
+	}
+	for provider, n := range entries { // fallback
+		res.Providers = append(res.Providers, VerifyProviderResult{Provider: provider, Entries: n})
+	}
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	m := d.mergeRun(fetched.list)
+	res.Files, res.Torrents = len(m.webSeedUrls), len(m.torrentUrls)
+	res.TorrentUrls = d.verifyTorrentUrls(ctx, m)
+	if ctx.Err() != nil {
+		res.Err = ctx.Err()
+	}
+	return res
+}
+
+// verifyTorrentUrls - HEAD of all .torrent urls, results sorted by name
+func (d *WebSeeds) verifyTorrentUrls(ctx context.Context, m *mergedManifests) []VerifyUrlResult {
+	names := make([]string, 0, len(m.torrentUrls))
+	for name := range m.torrentUrls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lock sync.Mutex
+	var res []VerifyUrlResult
+	var g errgroup.Group
+	g.SetLimit(verifyHeadWorkers)
+	for _, name := range names {
+		for _, u := range m.torrentUrls[name] {
+			name, u := name, u
+			g.Go(func() error {
+				err := ctx.Err()
+				if err == nil {
+					err = d.headTorrent(ctx, u)
+				}
+				lock.Lock()
+				defer lock.Unlock()
+				res = append(res, VerifyUrlResult{Name: name, Url: redactUrl(u), Err: err})
+				return nil
+			})
+		}
+	}
+	_ = g.Wait()
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Name != res[j].Name {
+			return res[i].Name < res[j].Name
+		}
+		return res[i].Url < res[j].Url
+	})
+	return res
+}
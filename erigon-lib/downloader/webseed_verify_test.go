@@ -0,0 +1,83 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsVerify(t *testing.T) {
+	require := require.New(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok/webseeds.toml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `
+"a.seg.torrent" = "http://%[1]s/a.seg.torrent"
+"b.seg.torrent" = "http://%[1]s/b.seg.torrent"
+"a.seg" = "http://%[1]s/a.seg"
+`, r.Host)
+	})
+	mux.HandleFunc("/other-chain/webseeds.toml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "chain = \"goerli\"\n\"c.seg.torrent\" = \"http://%s/c.seg.torrent\"\n", r.Host)
+	})
+	var gets atomic.Int32
+	mux.HandleFunc("/a.seg.torrent", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			gets.Add(1)
+		}
+		_, _ = w.Write(testTorrentBytes(t, "a.seg"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	providers := []*url.URL{}
+	for _, p := range []string{"/ok/webseeds.toml", "/other-chain/webseeds.toml", "/missing/webseeds.toml"} {
+		u, err := url.Parse(srv.URL + p)
+		require.NoError(err)
+		providers = append(providers, u)
+	}
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{ChainName: "mainnet", WebSeedDiscoveryByteBudget: datasize.MB})
+	ws.downloadTorrentFile = true
+	ws.bytesUsed = 1 // of previous Discover run
+	report := ws.Verify(context.Background(), nil, providers, nil)
+	require.NoError(report.Err)
+	require.False(report.Ok())
+	require.Len(report.Providers, 3)
+	require.Equal(3, report.Providers[0].Entries)
+	require.NoError(report.Providers[0].Err)
+	require.ErrorIs(report.Providers[1].Err, ErrManifestRejected)
+	require.Error(report.Providers[2].Err)
+	require.Equal(1, report.Files)
+	require.Equal(2, report.Torrents)
+	require.Len(report.TorrentUrls, 2)
+	require.Equal("a.seg.torrent", report.TorrentUrls[0].Name)
+	require.NoError(report.TorrentUrls[0].Err)
+	require.Equal("b.seg.torrent", report.TorrentUrls[1].Name)
+	require.Error(report.TorrentUrls[1].Err)
+
+	// node state not changed
+	require.Equal(int32(0), gets.Load())
+	require.Equal(0, ws.Len())
+	require.Empty(ws.TorrentUrls())
+	require.Equal(uint64(1), ws.bytesUsed)                                      // own budget: not counted into budget of Discover runs
+	require.Nil(ws.latency)                                                     // finished: doesn't leak into next Discover run
+	require.Equal(5, ws.Stats().Latency[srv.Listener.Addr().String()].Requests) // 3 manifests, 2 HEAD
+
+	mux.HandleFunc("/b.seg.torrent", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testTorrentBytes(t, "b.seg"))
+	})
+	report = ws.Verify(context.Background(), nil, providers[:1], nil)
+	require.True(report.Ok())
+
+	ws = newTestWebSeeds(t, &downloadercfg.Cfg{ChainName: "mainnet", WebSeedMinSuccessfulProviders: 2, WebSeedDisableFallback: true})
+	report = ws.Verify(context.Background(), nil, providers, nil)
+	require.ErrorIs(report.Err, ErrNotEnoughProviders)
+	require.Empty(report.TorrentUrls)
+}
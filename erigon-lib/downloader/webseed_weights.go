@@ -0,0 +1,86 @@
+package downloader
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const (
+	defaultWebSeedWeightRecovery = 0.1
+	// minAdaptiveWeight - failing host is still tried (after others) and can recover
+	minAdaptiveWeight = 0.01
+)
+
+func weightRecoveryOrDefault(recovery float64) float64 {
+	if recovery == 0 {
+		return defaultWebSeedWeightRecovery
+	}
+	return recovery
+}
+
+func checkAdaptiveWeights(decay, recovery float64) error {
+	if decay < 0 || decay >= 1 {
+		return fmt.Errorf("webseed weight decay must be in (0..1), got %v", decay)
+	}
+	if recovery < 0 || recovery > 1 {
+		return fmt.Errorf("webseed weight recovery must be in (0..1], got %v", recovery)
+	}
+	return nil
+}
+
+// observeHostResult - weights persist across Discover runs, for lifetime of WebSeeds
+func (d *WebSeeds) observeHostResult(request *http.Request, resp *http.Response, err error) {
+	if d.weightDecay == 0 || request.Context().Err() != nil { // cancelled by us - not host's fault
+		return
+	}
+	failed := d.isRetryable(resp, err)
+	host := request.URL.Host
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	w, ok := d.adaptiveWeights[host]
+	if !ok {
+		w = 1
+	}
+	if failed {
+		w *= d.weightDecay
+		if w < minAdaptiveWeight {
+			w = minAdaptiveWeight
+		}
+	} else {
+		w += (1 - w) * d.weightRecovery
+	}
+	if d.adaptiveWeights == nil {
+		d.adaptiveWeights = map[string]float64{}
+	}
+	d.adaptiveWeights[host] = w
+}
+
+// adaptiveWeightLocked - 1 if adaptive weights disabled or host has no requests yet
+func (d *WebSeeds) adaptiveWeightLocked(u *url.URL) float64 {
+	if w, ok := d.adaptiveWeights[u.Host]; ok {
+		return w
+	}
+	return 1
+}
+
+// orderByAdaptiveWeightLocked - new list, stable: urls of hosts with same weight keep order of manifests
+func (d *WebSeeds) orderByAdaptiveWeightLocked(urls metainfo.UrlList) metainfo.UrlList {
+	if len(d.adaptiveWeights) == 0 || len(urls) < 2 {
+		return urls
+	}
+	weights := make(map[string]float64, len(urls))
+	for _, u := range urls {
+		weights[u] = 1
+		if parsed, err := url.Parse(u); err == nil {
+			weights[u] = d.adaptiveWeightLocked(parsed)
+		}
+	}
+	res := make(metainfo.UrlList, len(urls))
+	copy(res, urls)
+	sort.SliceStable(res, func(i, j int) bool { return weights[res[i]] > weights[res[j]] })
+	return res
+}
@@ -0,0 +1,70 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/downloader/downloadercfg"
+	"github.com/ledgerwatch/erigon-lib/downloader/snaptype"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSeedsAdaptiveWeights(t *testing.T) {
+	require := require.New(t)
+	var flaky atomic.Bool
+	flaky.Store(true)
+	srvFlaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if flaky.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer srvFlaky.Close()
+	srvOk := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer srvOk.Close()
+	flakyUrl, okUrl := srvFlaky.URL+"/a.seg", srvOk.URL+"/a.seg"
+
+	_, err := NewWebSeeds(&downloadercfg.Cfg{WebSeedWeightDecay: 1}, log.New(), log.LvlInfo)
+	require.Error(err)
+
+	ws := newTestWebSeeds(t, &downloadercfg.Cfg{WebSeedWeightDecay: 0.5, WebSeedWeightRecovery: 0.5})
+	ws.Merge(snaptype.WebSeedUrls{"a.seg": {flakyUrl, okUrl}}, nil)
+	dst := filepath.Join(t.TempDir(), "a.seg")
+	require.NoError(ws.DownloadFile(context.Background(), "a.seg", dst)) // flaky fails, ok succeeds
+	urls, _ := ws.ByFileName("a.seg")
+	require.Equal([]string{okUrl, flakyUrl}, []string(urls))
+	flakyHost, okHost := strings.TrimPrefix(srvFlaky.URL, "http://"), strings.TrimPrefix(srvOk.URL, "http://")
+	require.Equal(map[string]float64{flakyHost: 0.5, okHost: 1}, ws.Stats().HostWeights)
+
+	// recovers on successes
+	for i := 0; i < 10; i++ {
+		require.NoError(ws.downloadFile(context.Background(), okUrl, dst, nil))
+	}
+	flaky.Store(false)
+	require.NoError(ws.downloadFile(context.Background(), flakyUrl, dst, nil))
+	require.Equal(0.75, ws.Stats().HostWeights[flakyHost])
+	urls, _ = ws.ByFileName("a.seg")
+	require.Equal([]string{okUrl, flakyUrl}, []string(urls))
+	for i := 0; i < 100; i++ {
+		require.NoError(ws.downloadFile(context.Background(), flakyUrl, dst, nil))
+	}
+	urls, _ = ws.ByFileName("a.seg")
+	require.Equal([]string{flakyUrl, okUrl}, []string(urls)) // same weight (1 after rounding) - order of manifest
+
+	ws = newTestWebSeeds(t, nil) // disabled by default
+	ws.Merge(snaptype.WebSeedUrls{"a.seg": {flakyUrl, okUrl}}, nil)
+	flaky.Store(true)
+	require.NoError(ws.DownloadFile(context.Background(), "a.seg", dst))
+	urls, _ = ws.ByFileName("a.seg")
+	require.Equal([]string{flakyUrl, okUrl}, []string(urls))
+	require.Nil(ws.Stats().HostWeights)
+}
@@ -145,6 +145,8 @@ var DefaultFlags = []cli.Flag{
 	&HealthCheckFlag,
 	&utils.HeimdallURLFlag,
 	&utils.WebSeedsFlag,
+	&utils.WebSeedTorrentsWhenSnapStopFlag,
+	&utils.WebSeedCommitmentTorrentsFlag,
 	&utils.WithoutHeimdallFlag,
 	&utils.HeimdallgRPCAddressFlag,
 	&utils.BorBlockPeriodFlag,